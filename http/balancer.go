@@ -0,0 +1,349 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ------------------------------- load balancer -------------------------------
+
+// how the balancer picks an endpoint
+type Strategy int
+
+const (
+	RoundRobin     Strategy = iota // one after the other
+	LeastInFlight                  // the endpoint with the fewest requests in flight
+	Weighted                       // smooth weighted round robin, by Endpoint weight
+	ConsistentHash                 // the same key always lands on the same endpoint while it is healthy
+)
+
+// spreads the requests of an HttpClient over several base urls. the scheme and host of every request
+// url (a plain path works too) are replaced with the picked endpoint. endpoints that keep failing are
+// ejected for a while, and with active health checks running, endpoints failing the check are skipped
+type Balancer struct {
+	EjectAfter         int                           // consecutive errors/5xx before an endpoint is ejected, default 5
+	EjectFor           time.Duration                 // how long an ejected endpoint is left alone, default 30s
+	MaxAttempts        int                           // endpoints tried per request, default all of them
+	RetryNonIdempotent bool                          // also fail POST and PATCH over to the next endpoint
+	HashKey            func(req *HttpRequest) string // key for ConsistentHash, default the url path
+
+	strategy  Strategy
+	mu        sync.Mutex
+	endpoints []*Endpoint
+	next      int
+	ring      []hashPoint
+	stop      chan struct{}
+	client    *HttpClient // set by HttpClient.SetBalancer, sends the health checks
+}
+
+// one base url of the pool
+type Endpoint struct {
+	URL    string
+	Weight int
+
+	inFlight     int
+	current      int // smooth weighted round robin state
+	failures     int
+	ejectedUntil time.Time
+	unhealthy    bool // failed the last active health check
+}
+
+type hashPoint struct {
+	hash     uint32
+	endpoint *Endpoint
+}
+
+// replicas on the hash ring per unit of weight
+const hashReplicas = 100
+
+// create a balancer over the given base urls, all with weight 1
+func NewBalancer(strategy Strategy, urls ...string) *Balancer {
+	b := &Balancer{strategy: strategy}
+	for _, u := range urls {
+		b.AddEndpoint(u, 1)
+	}
+	return b
+}
+
+// add a base url to the pool
+func (b *Balancer) AddEndpoint(baseURL string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.endpoints = append(b.endpoints, &Endpoint{URL: strings.TrimSuffix(baseURL, "/"), Weight: weight})
+	b.buildRing()
+}
+
+// remove a base url from the pool
+func (b *Balancer) RemoveEndpoint(baseURL string) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, ep := range b.endpoints {
+		if ep.URL == baseURL {
+			b.endpoints = append(b.endpoints[:i], b.endpoints[i+1:]...)
+			break
+		}
+	}
+	b.buildRing()
+}
+
+// base urls currently taking traffic
+func (b *Balancer) Healthy() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	healthy := []string{}
+	for _, ep := range b.endpoints {
+		if ep.available(now) {
+			healthy = append(healthy, ep.URL)
+		}
+	}
+	return healthy
+}
+
+// poll path on every endpoint each interval, anything but a 2xx takes the endpoint out of rotation
+// until it passes again. the checks use the transport of the client the balancer is attached to
+// (SetBalancer), attach it before starting them. stop with StopHealthChecks()
+func (b *Balancer) StartHealthChecks(path string, interval time.Duration) {
+	b.mu.Lock()
+	if b.stop != nil {
+		b.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	b.stop = stop
+	b.mu.Unlock()
+
+	check := func() {
+		b.mu.Lock()
+		endpoints := make([]*Endpoint, len(b.endpoints))
+		copy(endpoints, b.endpoints)
+		client := b.client
+		b.mu.Unlock()
+		if client == nil {
+			client = defaultClient
+		}
+
+		var wg sync.WaitGroup
+		for _, ep := range endpoints {
+			wg.Add(1)
+			go func(ep *Endpoint) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				defer cancel()
+				req := &HttpRequest{Method: "GET", Url: ep.URL + path, headers: map[string]string{}}
+				code, _, err := client.attempt(ctx, req, "GET", req.Url)
+				healthy := err == nil && code >= 200 && code <= 299
+
+				b.mu.Lock()
+				ep.unhealthy = !healthy
+				if healthy {
+					// a passing check also ends a passive ejection
+					ep.failures = 0
+					ep.ejectedUntil = time.Time{}
+				}
+				b.mu.Unlock()
+			}(ep)
+		}
+		wg.Wait()
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		check()
+		for {
+			select {
+			case <-ticker.C:
+				check()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (b *Balancer) StopHealthChecks() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+}
+
+// pick an endpoint that has not been tried yet for this request, nil when there is none left
+func (b *Balancer) pick(r *HttpRequest, url string, tried map[*Endpoint]bool) *Endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	candidates := []*Endpoint{}
+	for _, ep := range b.endpoints {
+		if !tried[ep] && ep.available(now) {
+			candidates = append(candidates, ep)
+		}
+	}
+	// everything is down, better to try something than to fail outright
+	if len(candidates) == 0 {
+		for _, ep := range b.endpoints {
+			if !tried[ep] {
+				candidates = append(candidates, ep)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var picked *Endpoint
+	switch b.strategy {
+	case LeastInFlight:
+		picked = candidates[0]
+		for _, ep := range candidates[1:] {
+			if ep.inFlight < picked.inFlight {
+				picked = ep
+			}
+		}
+	case Weighted:
+		total := 0
+		for _, ep := range candidates {
+			ep.current += ep.Weight
+			total += ep.Weight
+			if picked == nil || ep.current > picked.current {
+				picked = ep
+			}
+		}
+		picked.current -= total
+	case ConsistentHash:
+		picked = b.lookup(b.hashKey(r, url), candidates)
+	default:
+		picked = candidates[b.next%len(candidates)]
+		b.next++
+	}
+	picked.inFlight++
+	return picked
+}
+
+// passive health: count consecutive failures, eject the endpoint once there are too many
+func (b *Balancer) report(ep *Endpoint, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ep.inFlight--
+	if !failed {
+		ep.failures = 0
+		return
+	}
+	ep.failures++
+	if ep.failures >= b.ejectAfter() {
+		ep.ejectedUntil = time.Now().Add(b.ejectFor())
+		ep.failures = 0
+	}
+}
+
+func (b *Balancer) hashKey(r *HttpRequest, rawURL string) string {
+	if b.HashKey != nil {
+		return b.HashKey(r)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Path
+}
+
+// walk the ring clockwise from the key to the first candidate
+func (b *Balancer) lookup(key string, candidates []*Endpoint) *Endpoint {
+	allowed := make(map[*Endpoint]bool, len(candidates))
+	for _, ep := range candidates {
+		allowed[ep] = true
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(b.ring), func(i int) bool { return b.ring[i].hash >= hash })
+	for i := 0; i < len(b.ring); i++ {
+		point := b.ring[(start+i)%len(b.ring)]
+		if allowed[point.endpoint] {
+			return point.endpoint
+		}
+	}
+	return candidates[0]
+}
+
+// call with the lock held
+func (b *Balancer) buildRing() {
+	b.ring = b.ring[:0]
+	for _, ep := range b.endpoints {
+		for i := 0; i < hashReplicas*ep.Weight; i++ {
+			hash := crc32.ChecksumIEEE([]byte(ep.URL + "#" + strconv.Itoa(i)))
+			b.ring = append(b.ring, hashPoint{hash: hash, endpoint: ep})
+		}
+	}
+	sort.Slice(b.ring, func(i, j int) bool { return b.ring[i].hash < b.ring[j].hash })
+}
+
+func (b *Balancer) ejectAfter() int {
+	if b.EjectAfter <= 0 {
+		return 5
+	}
+	return b.EjectAfter
+}
+
+func (b *Balancer) ejectFor() time.Duration {
+	if b.EjectFor <= 0 {
+		return 30 * time.Second
+	}
+	return b.EjectFor
+}
+
+func (b *Balancer) maxAttempts() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.MaxAttempts <= 0 || b.MaxAttempts > len(b.endpoints) {
+		return len(b.endpoints)
+	}
+	return b.MaxAttempts
+}
+
+func (ep *Endpoint) available(now time.Time) bool {
+	return !ep.unhealthy && !now.Before(ep.ejectedUntil)
+}
+
+// send through the balancer, failing over to the next endpoint on errors and 5xx
+func (c *HttpClient) balanced(ctx context.Context, r *HttpRequest, method string, url string) (int, HttpResponse, error) {
+	b := c.balancer
+	attempts := b.maxAttempts()
+	if attempts == 0 {
+		return -1, HttpResponse{}, fmt.Errorf("balancer: no endpoints")
+	}
+	retryable := b.RetryNonIdempotent || (method != "POST" && method != "PATCH")
+
+	tried := map[*Endpoint]bool{}
+	var code int
+	var resp HttpResponse
+	var err error
+	for i := 0; i < attempts; i++ {
+		ep := b.pick(r, url, tried)
+		if ep == nil {
+			break
+		}
+		tried[ep] = true
+
+		code, resp, err = c.roundTrip(ctx, r, method, rebase(url, ep.URL))
+		failed := err != nil || code >= 500
+		b.report(ep, failed)
+		if !failed || !retryable || ctx.Err() != nil {
+			break
+		}
+	}
+	return code, resp, err
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"net/url"
+	"time"
+)
+
+// ------------------------------- clone & derive -------------------------------
+
+// Clone() and the With* methods never touch the request they are called on, so a base request can
+// be shared between goroutines and derived from concurrently. the Set*/Delete*/Encode methods
+// change the request in place. on requests out of RequestBuilder.Build() (and what With* derives
+// from them) they panic, those are read only values. on other requests only use them while a
+// single goroutine owns it, eg on a fresh Clone(). assigning Url or Method is never checked
+
+// deep copy of the request, always a writable one. signer and client are shared, they are safe
+// for concurrent use
+func (req *HttpRequest) Clone() *HttpRequest {
+	clone := *req
+	clone.frozen = false
+	clone.headers = req.GetHeaders()
+	if req.body != nil {
+		clone.body = append([]byte(nil), req.body...)
+	}
+	if req.expected != nil {
+		clone.expected = append([]int(nil), req.expected...)
+	}
+	return &clone
+}
+
+// a copy of the request with the header set, the request itself is left alone
+func (req *HttpRequest) WithHeader(key string, value string) *HttpRequest {
+	clone := req.Clone()
+	clone.headers[key] = value
+	clone.frozen = req.frozen
+	return clone
+}
+
+// a copy of the request with the query parameter added to its url
+func (req *HttpRequest) WithQuery(key string, value string) *HttpRequest {
+	clone := req.Clone()
+	// an unparsable url is left as is, sending it reports the error
+	clone.addQuery(url.Values{key: {value}})
+	clone.frozen = req.frozen
+	return clone
+}
+
+// a copy of the request with a new raw body
+func (req *HttpRequest) WithBody(body []byte) *HttpRequest {
+	clone := req.Clone()
+	clone.body = append([]byte(nil), body...)
+	clone.frozen = req.frozen
+	return clone
+}
+
+// send the request with its own Method, for requests that come out of a builder
+func (req *HttpRequest) Send() (int, HttpResponse, error) {
+	return req.send(req.Method)
+}
+
+// ------------------------------- builder -------------------------------
+
+// fluent builder for requests. every call returns a new builder, so a half built
+// builder can be used as a template from several goroutines. errors surface in Build()
+type RequestBuilder struct {
+	method string
+	url    string
+	opts   []Option
+}
+
+// start building a request
+func NewRequestBuilder(method string, url string) *RequestBuilder {
+	return &RequestBuilder{method: method, url: url}
+}
+
+// apply any of the quick function options (WithHeader, WithJSON ...)
+func (b *RequestBuilder) With(opts ...Option) *RequestBuilder {
+	next := &RequestBuilder{method: b.method, url: b.url}
+	next.opts = make([]Option, 0, len(b.opts)+len(opts))
+	next.opts = append(next.opts, b.opts...)
+	next.opts = append(next.opts, opts...)
+	return next
+}
+
+func (b *RequestBuilder) Header(key string, value string) *RequestBuilder {
+	return b.With(WithHeader(key, value))
+}
+
+func (b *RequestBuilder) Headers(headers map[string]string) *RequestBuilder {
+	// copy now, later changes to the caller's map must not leak into the requests
+	copied := make(map[string]string, len(headers))
+	for key, value := range headers {
+		copied[key] = value
+	}
+	return b.With(WithHeaders(copied))
+}
+
+func (b *RequestBuilder) Query(key string, value string) *RequestBuilder {
+	return b.With(WithQuery(key, value))
+}
+
+func (b *RequestBuilder) BearerToken(token string) *RequestBuilder {
+	return b.With(WithBearerToken(token))
+}
+
+func (b *RequestBuilder) BasicAuth(username string, password string) *RequestBuilder {
+	return b.With(WithBasicAuth(username, password))
+}
+
+// json body, v is encoded when the request is built
+func (b *RequestBuilder) JSON(v any) *RequestBuilder {
+	return b.With(WithJSON(v))
+}
+
+func (b *RequestBuilder) Body(v any, encoder BodyEncoder) *RequestBuilder {
+	return b.With(WithBody(v, encoder))
+}
+
+func (b *RequestBuilder) RawBody(body []byte, contentType string) *RequestBuilder {
+	return b.With(WithRawBody(append([]byte(nil), body...), contentType))
+}
+
+func (b *RequestBuilder) Timeout(timeout time.Duration) *RequestBuilder {
+	return b.With(WithTimeout(timeout))
+}
+
+func (b *RequestBuilder) ExpectStatus(codes ...int) *RequestBuilder {
+	return b.With(WithExpectedStatus(append([]int(nil), codes...)...))
+}
+
+func (b *RequestBuilder) Signer(signer Signer) *RequestBuilder {
+	return b.With(WithSigner(signer))
+}
+
+func (b *RequestBuilder) Client(client *HttpClient) *RequestBuilder {
+	return b.With(WithClient(client))
+}
+
+func (b *RequestBuilder) Timing() *RequestBuilder {
+	return b.With(WithTiming())
+}
+
+// build a fresh, read only request. every call returns a new one sharing nothing with earlier
+// ones, Clone() it to change it
+func (b *RequestBuilder) Build() (*HttpRequest, error) {
+	req := &HttpRequest{Method: b.method, Url: b.url, headers: make(map[string]string)}
+	for _, opt := range b.opts {
+		if err := opt(req); err != nil {
+			return nil, err
+		}
+	}
+	req.frozen = true
+	return req, nil
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// run with -race: derived and built requests must not share anything mutable with their base
+func TestSharedBaseConcurrentDerive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Header.Get("X-Worker"), r.URL.RawQuery)
+	}))
+	defer srv.Close()
+
+	base, err := NewHttpRequest("POST", srv.URL+"/items?v=1", map[string]int{"n": 1}, map[string]string{"Accept": "application/json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := NewRequestBuilder("POST", srv.URL+"/items").Header("Accept", "application/json").RawBody([]byte("raw"), "text/plain")
+	shared, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			worker := fmt.Sprint(i)
+
+			derived := base.WithHeader("X-Worker", worker).WithQuery("page", worker).WithBody([]byte(worker))
+			clone := base.Clone()
+			clone.SetHeader("X-Clone", worker) // owned by this goroutine
+			clone.Url += "&clone=" + worker
+
+			built, err := builder.Header("X-Worker", worker).Query("page", worker).Build()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			built = built.WithHeader("X-Built", worker)
+			fromShared := shared.WithHeader("X-Worker", worker).WithQuery("page", worker)
+
+			for _, req := range []*HttpRequest{derived, built, fromShared} {
+				code, resp, err := req.Send()
+				if err != nil || code != 200 {
+					t.Errorf("send: %d %v", code, err)
+					return
+				}
+				if want := worker + " "; !strings.HasPrefix(string(resp.Body), want) || !strings.Contains(string(resp.Body), "page="+worker) {
+					t.Errorf("worker %s got %q", worker, resp.Body)
+				}
+			}
+			if string(derived.body) != worker || string(built.body) != "raw" {
+				t.Errorf("bodies %q %q", derived.body, built.body)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// the base and the builder came out untouched
+	if base.Url != srv.URL+"/items?v=1" || len(base.GetHeaders()) != 1 || string(base.body) != `{"n":1}` {
+		t.Errorf("base changed: %s %v %s", base.Url, base.GetHeaders(), base.body)
+	}
+	req, _ := builder.Build()
+	if len(req.GetHeaders()) != 2 || req.Url != srv.URL+"/items" || string(req.body) != "raw" {
+		t.Errorf("builder changed: %s %v %s", req.Url, req.GetHeaders(), req.body)
+	}
+}
+
+// every Build() returns a request of its own, nothing is shared between builds
+func TestBuildIndependent(t *testing.T) {
+	builder := NewRequestBuilder("PUT", "https://example.com/a").RawBody([]byte("abc"), "text/plain").ExpectStatus(200, 204)
+	first, _ := builder.Build()
+	second, _ := builder.Build()
+
+	first.body[0] = 'x'
+	first.expected[0] = 500
+	first.headers["Content-Type"] = "application/json"
+
+	if string(second.body) != "abc" || second.expected[0] != 200 || second.GetHeader("Content-Type") != "text/plain" {
+		t.Errorf("builds share state: %s %v %v", second.body, second.expected, second.GetHeaders())
+	}
+}
+
+// built requests (and what With* derives from them) are read only, a Clone() is writable
+func TestBuiltRequestReadOnly(t *testing.T) {
+	built, err := NewRequestBuilder("GET", "https://example.com/a").Header("X-A", "1").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setters := map[string]func(req *HttpRequest){
+		"SetHeader":         func(req *HttpRequest) { req.SetHeader("X-B", "2") },
+		"DeleteHeader":      func(req *HttpRequest) { req.DeleteHeader("X-A") },
+		"DeleteHeaders":     func(req *HttpRequest) { req.DeleteHeaders() },
+		"SetTimeout":        func(req *HttpRequest) { req.SetTimeout(time.Second) },
+		"SetExpectedStatus": func(req *HttpRequest) { req.SetExpectedStatus(200) },
+		"Encode":            func(req *HttpRequest) { req.Encode(1) },
+	}
+	for name, set := range setters {
+		for _, req := range []*HttpRequest{built, built.WithHeader("X-C", "3")} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("%s on a built request did not panic", name)
+					}
+				}()
+				set(req)
+			}()
+		}
+	}
+	if headers := built.GetHeaders(); len(headers) != 1 || headers["X-A"] != "1" {
+		t.Errorf("built request changed: %v", headers)
+	}
+
+	clone := built.Clone()
+	clone.SetHeader("X-B", "2")
+	if clone.GetHeader("X-B") != "2" || built.GetHeader("X-B") != "" {
+		t.Errorf("clone %v, built %v", clone.GetHeaders(), built.GetHeaders())
+	}
+}
+
+func TestWithQueryKeepsExistingQuery(t *testing.T) {
+	req := &HttpRequest{Url: "https://x.com/a?b=1&a=%2F&c", headers: map[string]string{}}
+	got := req.WithQuery("d", "x y").Url
+	if want := "https://x.com/a?b=1&a=%2F&c&d=x+y"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,389 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ------------------------------- record / replay -------------------------------
+
+// what a cassette does with a request
+type CassetteMode int
+
+const (
+	CassetteReplay         CassetteMode = iota // serve from the cassette, unmatched requests fail, no network
+	CassetteRecord                             // always go to the network, the cassette is rewritten from scratch
+	CassetteReplayOrRecord                     // serve what matches, record what does not
+)
+
+// an http.RoundTripper that records real exchanges to a file and replays them later, for tests that
+// must not depend on live upstreams. plug it into a client with SetTransport(). the file format
+// follows the extension: .yaml/.yml or .jsonl (one interaction per line).
+// everything is redacted before it is written, so cassettes can be committed. incoming requests are
+// redacted the same way before matching, so they still match the masked recordings
+type Cassette struct {
+	Matchers  []CassetteMatcher // all must agree for an interaction to match, default method and url
+	Redaction *RedactionPolicy  // default the package policy (see SetRedactionPolicy)
+	Transport http.RoundTripper // the real network when recording, default http.DefaultTransport
+
+	path         string
+	mode         CassetteMode
+	mu           sync.Mutex
+	interactions []*CassetteInteraction
+	played       []bool
+}
+
+// one recorded exchange
+type CassetteInteraction struct {
+	Request    CassetteRequest  `yaml:"request" json:"request"`
+	Response   CassetteResponse `yaml:"response" json:"response"`
+	RecordedAt time.Time        `yaml:"recorded_at" json:"recorded_at"`
+}
+
+type CassetteRequest struct {
+	Method       string              `yaml:"method" json:"method"`
+	URL          string              `yaml:"url" json:"url"`
+	Headers      map[string][]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Body         string              `yaml:"body,omitempty" json:"body,omitempty"`
+	BodyEncoding string              `yaml:"body_encoding,omitempty" json:"body_encoding,omitempty"` // "base64" for binary bodies
+}
+
+type CassetteResponse struct {
+	StatusCode   int                 `yaml:"status" json:"status"`
+	Headers      map[string][]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Body         string              `yaml:"body,omitempty" json:"body,omitempty"`
+	BodyEncoding string              `yaml:"body_encoding,omitempty" json:"body_encoding,omitempty"`
+}
+
+// decides whether a live request (already redacted) matches a recorded one
+type CassetteMatcher func(live *CassetteRequest, recorded *CassetteRequest) bool
+
+// open a cassette. replay modes load the file, CassetteReplay requires it to exist
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{path: path, mode: mode}
+	if mode == CassetteRecord {
+		return c, nil
+	}
+	if err := c.load(); err != nil {
+		if mode == CassetteReplayOrRecord && os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// recorded interactions, in order
+func (c *Cassette) Interactions() []*CassetteInteraction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*CassetteInteraction(nil), c.interactions...)
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	policy := c.policy()
+	live := newCassetteRequest(policy, req, body)
+
+	if c.mode != CassetteRecord {
+		if interaction := c.match(live); interaction != nil {
+			return interaction.Response.httpResponse(req)
+		}
+		if c.mode == CassetteReplay {
+			return nil, fmt.Errorf("cassette: no recorded interaction matches %s %s", live.Method, live.URL)
+		}
+	}
+
+	// go to the network with the untouched request
+	outgoing := req.Clone(req.Context())
+	outgoing.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := c.transport().RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := &CassetteInteraction{Request: *live, RecordedAt: time.Now().UTC()}
+	interaction.Response.StatusCode = resp.StatusCode
+	interaction.Response.Headers = redactedHeader(policy, resp.Header)
+	delete(interaction.Response.Headers, "Content-Length") // redaction changes the length, replay sets it from the body
+	interaction.Response.Body, interaction.Response.BodyEncoding = cassetteBody(policy.Body(respBody))
+	if err := c.add(interaction); err != nil {
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+// first interaction that matches and has not been played yet. once all matching ones were played
+// the last of them keeps answering, for clients that repeat requests
+func (c *Cassette) match(live *CassetteRequest) *CassetteInteraction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var last *CassetteInteraction
+	for i, interaction := range c.interactions {
+		if !c.matches(live, &interaction.Request) {
+			continue
+		}
+		if !c.played[i] {
+			c.played[i] = true
+			return interaction
+		}
+		last = interaction
+	}
+	return last
+}
+
+func (c *Cassette) matches(live *CassetteRequest, recorded *CassetteRequest) bool {
+	matchers := c.Matchers
+	if len(matchers) == 0 {
+		matchers = []CassetteMatcher{MatchMethod, MatchURL}
+	}
+	for _, matcher := range matchers {
+		if !matcher(live, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+// record an interaction and write the cassette out, so an aborted test run keeps what it recorded
+func (c *Cassette) add(interaction *CassetteInteraction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, interaction)
+	c.played = append(c.played, true)
+	return c.save()
+}
+
+// ------------------------------- matchers -------------------------------
+
+func MatchMethod(live *CassetteRequest, recorded *CassetteRequest) bool {
+	return strings.EqualFold(live.Method, recorded.Method)
+}
+
+// scheme, host, path and query, the order of query parameters does not matter
+func MatchURL(live *CassetteRequest, recorded *CassetteRequest) bool {
+	a, errA := url.Parse(live.URL)
+	b, errB := url.Parse(recorded.URL)
+	if errA != nil || errB != nil {
+		return live.URL == recorded.URL
+	}
+	return a.Scheme == b.Scheme && a.Host == b.Host && a.Path == b.Path && reflect.DeepEqual(a.Query(), b.Query())
+}
+
+// scheme, host and path only
+func MatchPath(live *CassetteRequest, recorded *CassetteRequest) bool {
+	a, errA := url.Parse(live.URL)
+	b, errB := url.Parse(recorded.URL)
+	if errA != nil || errB != nil {
+		return live.URL == recorded.URL
+	}
+	return a.Scheme == b.Scheme && a.Host == b.Host && a.Path == b.Path
+}
+
+// equal bodies, json bodies are compared by value so key order and spacing do not matter
+func MatchBody(live *CassetteRequest, recorded *CassetteRequest) bool {
+	if live.Body == recorded.Body {
+		return true
+	}
+	a, errA := decodeJSONNumbers(live.Body)
+	b, errB := decodeJSONNumbers(recorded.Body)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// numbers stay json.Number, big integers must not collapse into the same float64
+func decodeJSONNumbers(body string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	var v interface{}
+	err := decoder.Decode(&v)
+	return v, err
+}
+
+// a matcher comparing the values of the given headers
+func MatchHeaders(names ...string) CassetteMatcher {
+	return func(live *CassetteRequest, recorded *CassetteRequest) bool {
+		for _, name := range names {
+			key := http.CanonicalHeaderKey(name)
+			if !reflect.DeepEqual(live.Headers[key], recorded.Headers[key]) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ------------------------------- conversion -------------------------------
+
+func newCassetteRequest(policy *RedactionPolicy, req *http.Request, body []byte) *CassetteRequest {
+	r := &CassetteRequest{Method: req.Method, URL: policy.URL(req.URL.String()), Headers: redactedHeader(policy, req.Header)}
+	r.Body, r.BodyEncoding = cassetteBody(policy.Body(body))
+	return r
+}
+
+func (r *CassetteResponse) httpResponse(req *http.Request) (*http.Response, error) {
+	body := []byte(r.Body)
+	if r.BodyEncoding == "base64" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(r.Body); err != nil {
+			return nil, fmt.Errorf("cassette: bad response body: %w", err)
+		}
+	}
+	header := http.Header{}
+	for key, values := range r.Headers {
+		header[key] = append([]string(nil), values...)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func redactedHeader(policy *RedactionPolicy, header http.Header) map[string][]string {
+	if len(header) == 0 {
+		return nil
+	}
+	redacted := make(map[string][]string, len(header))
+	for key, values := range header {
+		for _, value := range values {
+			redacted[key] = append(redacted[key], policy.Header(key, value))
+		}
+	}
+	return redacted
+}
+
+// text bodies are stored as is, binary ones in base64
+func cassetteBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer req.Body.Close()
+	return io.ReadAll(req.Body)
+}
+
+// ------------------------------- file -------------------------------
+
+func (c *Cassette) load() error {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+	var interactions []*CassetteInteraction
+	if c.jsonl() {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), 64<<20)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			interaction := &CassetteInteraction{}
+			if err := json.Unmarshal(line, interaction); err != nil {
+				return fmt.Errorf("cassette: %s: %w", c.path, err)
+			}
+			interactions = append(interactions, interaction)
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	} else {
+		var file struct {
+			Interactions []*CassetteInteraction `yaml:"interactions"`
+		}
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("cassette: %s: %w", c.path, err)
+		}
+		interactions = file.Interactions
+	}
+	c.interactions = interactions
+	c.played = make([]bool, len(interactions))
+	return nil
+}
+
+// call with the lock held
+func (c *Cassette) save() error {
+	var buf bytes.Buffer
+	if c.jsonl() {
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		for _, interaction := range c.interactions {
+			if err := encoder.Encode(interaction); err != nil {
+				return err
+			}
+		}
+	} else {
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		file := struct {
+			Interactions []*CassetteInteraction `yaml:"interactions"`
+		}{c.interactions}
+		if err := encoder.Encode(file); err != nil {
+			return err
+		}
+	}
+	if dir := filepath.Dir(c.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(c.path, buf.Bytes(), 0644)
+}
+
+func (c *Cassette) jsonl() bool {
+	return strings.EqualFold(filepath.Ext(c.path), ".jsonl")
+}
+
+func (c *Cassette) policy() *RedactionPolicy {
+	if c.Redaction != nil {
+		return c.Redaction
+	}
+	return GetRedactionPolicy()
+}
+
+func (c *Cassette) transport() http.RoundTripper {
+	if c.Transport != nil {
+		return c.Transport
+	}
+	return http.DefaultTransport
+}
@@ -0,0 +1,70 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassetteRoundTrip(t *testing.T) {
+	const payload = `{"id":12345678901234567891,"z":1,"a":"<b>"}`
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, payload)
+	}))
+	defer server.Close()
+
+	for _, name := range []string{"api.yaml", "api.jsonl"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			send := func(cassette *Cassette, path string, body string) (*http.Response, error) {
+				client := NewHttpClient()
+				client.SetTransport(cassette)
+				req, _ := http.NewRequest("POST", server.URL+path, strings.NewReader(body))
+				return client.client.Do(req)
+			}
+
+			recorder, err := NewCassette(path, CassetteRecord)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := send(recorder, "/items", `{"n":12345678901234567891}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			hits = 0
+			player, err := NewCassette(path, CassetteReplay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			player.Matchers = []CassetteMatcher{MatchMethod, MatchURL, MatchBody}
+			resp, err = send(player, "/items", `{"n":12345678901234567891}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != payload {
+				t.Errorf("replayed %s, want %s", body, payload)
+			}
+			if hits != 0 {
+				t.Error("replay went to the network")
+			}
+
+			// a body differing in the last digits of a big number must not match
+			if _, err := send(player, "/items", `{"n":12345678901234567892}`); err == nil {
+				t.Error("request with another body matched")
+			}
+			if _, err := send(player, "/other", `{"n":12345678901234567891}`); err == nil || !strings.Contains(err.Error(), "no recorded interaction") {
+				t.Errorf("unmatched request: %v", err)
+			}
+		})
+	}
+}
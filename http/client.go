@@ -0,0 +1,218 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// ------------------------------- client -------------------------------
+
+// a reusable http client. attach it to requests with SetClient(), requests without one
+// are sent through a plain net/http client
+type HttpClient struct {
+	client    *http.Client
+	hedge     *HedgePolicy
+	recorder  *HarRecorder
+	balancer  *Balancer
+	logger    *log.Logger
+	validator *OpenAPIValidator
+}
+
+// used by every request that has no client attached
+var defaultClient = NewHttpClient()
+
+// create a new http client
+func NewHttpClient() *HttpClient {
+	return &HttpClient{client: &http.Client{}}
+}
+
+// overall timeout of a single attempt, 0 means no timeout
+func (c *HttpClient) SetTimeout(timeout time.Duration) {
+	c.client.Timeout = timeout
+}
+
+// replace the underlying transport, eg to tune connection pooling or to stub the network
+func (c *HttpClient) SetTransport(transport http.RoundTripper) {
+	c.client.Transport = transport
+}
+
+// enable hedging for idempotent requests, pass nil to turn it off again
+func (c *HttpClient) SetHedgePolicy(policy *HedgePolicy) {
+	c.hedge = policy
+}
+
+// record every exchange of this client in HAR format, pass nil to stop recording
+func (c *HttpClient) SetRecorder(recorder *HarRecorder) {
+	c.recorder = recorder
+}
+
+// spread requests over a pool of base urls, pass nil to go back to the request urls. the health
+// checks of the balancer go through this client as well
+func (c *HttpClient) SetBalancer(balancer *Balancer) {
+	c.balancer = balancer
+	if balancer != nil {
+		balancer.mu.Lock()
+		balancer.client = c
+		balancer.mu.Unlock()
+	}
+}
+
+// log one line per attempt (method, url, status, duration), credentials are masked by the
+// redaction policy. pass nil to stop logging
+func (c *HttpClient) SetLogger(logger *log.Logger) {
+	c.logger = logger
+}
+
+// send the request with its own Method and Url
+func (c *HttpClient) Do(r *HttpRequest) (int, HttpResponse, error) {
+	return c.do(r, r.Method, r.Url)
+}
+
+func (c *HttpClient) do(r *HttpRequest, method string, url string) (int, HttpResponse, error) {
+	return c.doContext(context.Background(), r, method, url)
+}
+
+func (c *HttpClient) doContext(ctx context.Context, r *HttpRequest, method string, url string) (int, HttpResponse, error) {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	var validation *openapi3filter.RequestValidationInput
+	if c.validator != nil {
+		var err error
+		if validation, err = c.validator.request(ctx, r, method, url); err != nil {
+			return -1, HttpResponse{}, err
+		}
+	}
+
+	var code int
+	var resp HttpResponse
+	var err error
+	if c.balancer != nil {
+		code, resp, err = c.balanced(ctx, r, method, url)
+	} else {
+		code, resp, err = c.roundTrip(ctx, r, method, url)
+	}
+	if err == nil && validation != nil {
+		err = c.validator.response(ctx, validation, resp)
+	}
+	if err == nil && !r.expects(code) {
+		err = &StatusError{StatusCode: code, Body: resp.Body}
+	}
+	return code, resp, err
+}
+
+// one logical round trip to one url, hedged when the policy says so
+func (c *HttpClient) roundTrip(ctx context.Context, r *HttpRequest, method string, url string) (int, HttpResponse, error) {
+	if c.hedge != nil && c.hedge.applies(method) {
+		return c.hedged(ctx, r, method, url)
+	}
+	return c.attempt(ctx, r, method, url)
+}
+
+// a single round trip, the response body is fully read before returning
+func (c *HttpClient) attempt(ctx context.Context, r *HttpRequest, method string, url string) (int, HttpResponse, error) {
+	req, err := newRequest(ctx, r, method, url)
+	if err != nil {
+		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
+	}
+
+	// the har recorder needs the timings as well
+	var trace *timingTrace
+	if r.timing || c.recorder != nil {
+		trace = newTimingTrace()
+		req = req.WithContext(trace.context(ctx))
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		err = redactError(err)
+		c.record(harExchange{request: req, requestBody: r.body, err: err, trace: trace})
+		c.log(method, url, -1, start, err)
+		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
+	}
+	defer resp.Body.Close()
+
+	// Read the response body into a []byte variable
+	body, err := ioutil.ReadAll(resp.Body)
+	if trace != nil {
+		trace.finish()
+	}
+	c.record(harExchange{request: req, requestBody: r.body, response: resp, responseBody: body, err: err, trace: trace})
+	c.log(method, url, resp.StatusCode, start, err)
+	if err != nil {
+		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
+	}
+
+	// return this object
+	httpResponse := HttpResponse{}
+	httpResponse.StatusCode = resp.StatusCode
+	httpResponse.Body = body
+	httpResponse.Headers = headerMap(resp.Header)
+	if r.timing {
+		httpResponse.Timing = trace.timing()
+	}
+
+	return resp.StatusCode, httpResponse, nil
+}
+
+// a single round trip that hands back the open response, for bodies too big to buffer.
+// the caller closes the body. hedging, recording and timing do not apply
+func (c *HttpClient) stream(ctx context.Context, r *HttpRequest, method string, url string) (*http.Response, error) {
+	req, err := newRequest(ctx, r, method, url)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	return resp, redactError(err)
+}
+
+// build the net/http request out of an HttpRequest
+func newRequest(ctx context.Context, r *HttpRequest, method string, url string) (*http.Request, error) {
+	// Create a new HTTP request with the request body and headers
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(r.body))
+	if err != nil {
+		return nil, redactError(err)
+	}
+
+	// Set the request headers
+	for key, value := range r.headers {
+		req.Header.Set(key, value)
+	}
+
+	// sign the request as the very last step, so the signature covers the final headers
+	if r.signer != nil {
+		if err = r.signer.Sign(req, r.body); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+func (c *HttpClient) record(x harExchange) {
+	if c.recorder != nil {
+		c.recorder.record(x)
+	}
+}
+
+func (c *HttpClient) log(method string, url string, code int, start time.Time, err error) {
+	if c.logger == nil {
+		return
+	}
+	url = GetRedactionPolicy().URL(url)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		c.logger.Printf("%s %s -> error after %v: %v", method, url, elapsed, err)
+		return
+	}
+	c.logger.Printf("%s %s -> %d in %v", method, url, code, elapsed)
+}
@@ -0,0 +1,389 @@
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ------------------------------- curl export -------------------------------
+
+// render the request as a shell escaped curl command, handy for bug reports
+func (req *HttpRequest) Curl() string {
+	return req.curl(false)
+}
+
+// same as Curl(), with headers, query parameters and body fields masked by the redaction policy
+func (req *HttpRequest) CurlRedacted() string {
+	return req.curl(true)
+}
+
+func (req *HttpRequest) curl(redact bool) string {
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = "GET"
+	}
+
+	policy := GetRedactionPolicy()
+	rawURL := req.Url
+	if redact {
+		rawURL = policy.URL(rawURL)
+	}
+	parts := []string{"curl", "-X", method, shellQuote(rawURL)}
+
+	headers := req.GetHeaders()
+	// without a header the body is what NewHttpRequest()/Encode() made of it, json. say so, or
+	// curl (and NewHttpRequestFromCurl) would send it as a form
+	if _, found := headerLookup(headers, "Content-Type"); !found && hasBody(req.body) && json.Valid(req.body) {
+		headers["Content-Type"] = "application/json"
+	}
+
+	// sorted, so the same request always renders the same command
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := headers[key]
+		if redact {
+			value = policy.Header(key, value)
+		}
+		parts = append(parts, "-H", shellQuote(key+": "+value))
+	}
+
+	if hasBody(req.body) {
+		body := req.body
+		if redact {
+			body = policy.Body(body)
+		}
+		parts = append(parts, "--data-raw", shellQuote(string(body)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// NewHttpRequest marshals a nil body into "null", which is not worth sending around
+func hasBody(body []byte) bool {
+	return len(body) > 0 && string(body) != "null"
+}
+
+// wrap in single quotes, embedded single quotes are closed, escaped and reopened
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./:=@%+,", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ------------------------------- curl import -------------------------------
+
+// curl flags that take an argument which is of no use for an HttpRequest
+var curlIgnoredWithArg = map[string]bool{
+	"-o": true, "--output": true, "-m": true, "--max-time": true, "--connect-timeout": true,
+	"-w": true, "--write-out": true, "--retry": true, "--retry-delay": true, "--retry-max-time": true,
+	"-x": true, "--proxy": true, "-U": true, "--proxy-user": true, "--noproxy": true,
+	"--cacert": true, "--capath": true, "-E": true, "--cert": true, "--cert-type": true, "--key": true,
+	"--key-type": true, "-c": true, "--cookie-jar": true, "--max-redirs": true, "--resolve": true,
+	"--connect-to": true, "--interface": true, "--limit-rate": true, "-D": true, "--dump-header": true,
+	"--trace": true, "--trace-ascii": true, "--stderr": true, "-y": true, "--speed-time": true,
+	"-Y": true, "--speed-limit": true, "--keepalive-time": true, "--expect100-timeout": true,
+	"--dns-servers": true, "--local-port": true, "--unix-socket": true, "--ciphers": true,
+}
+
+// curl flags without an argument that do not change the request (-G and -I do, see below)
+var curlSwitches = map[string]bool{
+	"-s": true, "--silent": true, "-S": true, "--show-error": true, "-k": true, "--insecure": true,
+	"-L": true, "--location": true, "--location-trusted": true, "-v": true, "--verbose": true,
+	"-i": true, "--include": true, "--compressed": true, "-f": true, "--fail": true, "--fail-with-body": true,
+	"-g": true, "--globoff": true, "-N": true, "--no-buffer": true, "-#": true, "--progress-bar": true,
+	"--no-progress-meter": true, "-q": true, "-0": true, "--http1.0": true, "--http1.1": true, "--http2": true,
+	"--http2-prior-knowledge": true, "--tlsv1.2": true, "--tlsv1.3": true, "-4": true, "--ipv4": true,
+	"-6": true, "--ipv6": true, "--no-keepalive": true, "--raw": true, "--tcp-nodelay": true,
+	"-O": true, "--remote-name": true, "-J": true, "--remote-header-name": true, "--create-dirs": true,
+	"-n": true, "--netrc": true, "--basic": true, "--path-as-is": true, "--retry-connrefused": true,
+	"--retry-all-errors": true, "--post301": true, "--post302": true, "--post303": true,
+	"-G": true, "--get": true, "-I": true, "--head": true,
+}
+
+// create a new http request object from a curl command line.
+// understands -X, -H, -d/--data/--data-raw/--data-binary, -F, -u, -A, -b, -G, -I and --url. flags
+// that do not change the request (-s, -L, -o file, ...) are skipped, unknown ones are an error
+func NewHttpRequestFromCurl(command string) (*HttpRequest, error) {
+	args, err := shellSplit(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 0 && (args[0] == "curl" || strings.HasSuffix(args[0], "/curl")) {
+		args = args[1:]
+	}
+
+	req := &HttpRequest{headers: make(map[string]string)}
+	var data []string
+	var form [][2]string
+	get, head := false, false
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		// positional url
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			req.Url = arg
+			continue
+		}
+
+		flag, value, attached := splitCurlFlag(arg)
+		// bundled short switches, "-sSL" or "-sXPOST"
+		for attached && curlSwitches[flag] {
+			get = get || flag == "-G"
+			head = head || flag == "-I"
+			flag, value = "-"+value[:1], value[1:]
+			attached = value != ""
+		}
+		if curlIgnoredWithArg[flag] {
+			if !attached {
+				i++
+			}
+			continue
+		}
+		if curlSwitches[flag] {
+			get = get || flag == "-G" || flag == "--get"
+			head = head || flag == "-I" || flag == "--head"
+			continue
+		}
+		if !curlTakesArg(flag) {
+			return nil, fmt.Errorf("curl: unsupported flag %s", flag)
+		}
+
+		if !attached {
+			i++
+			if i >= len(args) {
+				return nil, fmt.Errorf("curl: %s needs an argument", flag)
+			}
+			value = args[i]
+		}
+
+		switch flag {
+		case "-X", "--request":
+			req.Method = strings.ToUpper(value)
+		case "--url":
+			req.Url = value
+		case "-H", "--header":
+			key, val, found := strings.Cut(value, ":")
+			if !found {
+				return nil, fmt.Errorf("curl: bad header %q", value)
+			}
+			req.headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		case "-d", "--data", "--data-ascii", "--data-binary":
+			if strings.HasPrefix(value, "@") {
+				content, err := ioutil.ReadFile(value[1:])
+				if err != nil {
+					return nil, err
+				}
+				value = string(content)
+				if flag != "--data-binary" {
+					value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+				}
+			}
+			data = append(data, value)
+		case "--data-raw":
+			data = append(data, value)
+		case "--data-urlencode":
+			data = append(data, curlURLEncode(value))
+		case "-F", "--form":
+			name, val, found := strings.Cut(value, "=")
+			if !found {
+				return nil, fmt.Errorf("curl: bad form field %q", value)
+			}
+			form = append(form, [2]string{name, val})
+		case "-u", "--user":
+			req.headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(value))
+		case "-A", "--user-agent":
+			req.headers["User-Agent"] = value
+		case "-b", "--cookie":
+			req.headers["Cookie"] = value
+		case "-e", "--referer":
+			req.headers["Referer"] = value
+		}
+	}
+
+	if req.Url == "" {
+		return nil, fmt.Errorf("curl: no url in command")
+	}
+
+	switch {
+	case len(form) > 0:
+		body, contentType, err := curlMultipart(form)
+		if err != nil {
+			return nil, err
+		}
+		req.body = body
+		req.headers["Content-Type"] = contentType
+	case len(data) > 0 && get:
+		// -G moves the data into the query string
+		separator := "?"
+		if strings.Contains(req.Url, "?") {
+			separator = "&"
+		}
+		req.Url += separator + strings.Join(data, "&")
+	case len(data) > 0:
+		req.body = []byte(strings.Join(data, "&"))
+		if _, ok := headerLookup(req.headers, "Content-Type"); !ok {
+			req.headers["Content-Type"] = "application/x-www-form-urlencoded"
+		}
+	}
+
+	// same defaults as curl itself
+	if req.Method == "" {
+		req.Method = "GET"
+		if head {
+			req.Method = "HEAD"
+		} else if len(req.body) > 0 {
+			req.Method = "POST"
+		}
+	}
+	return req, nil
+}
+
+// "-XPOST" and "--request" style flags, returns the flag, any attached value and whether there was one
+func splitCurlFlag(arg string) (string, string, bool) {
+	if strings.HasPrefix(arg, "--") || len(arg) <= 2 {
+		return arg, "", false
+	}
+	return arg[:2], arg[2:], true
+}
+
+func curlTakesArg(flag string) bool {
+	switch flag {
+	case "-X", "--request", "--url", "-H", "--header", "-d", "--data", "--data-ascii", "--data-binary",
+		"--data-raw", "--data-urlencode", "-F", "--form", "-u", "--user", "-A", "--user-agent",
+		"-b", "--cookie", "-e", "--referer":
+		return true
+	}
+	return false
+}
+
+// --data-urlencode takes "content", "=content" or "name=content"
+func curlURLEncode(value string) string {
+	name, content, found := strings.Cut(value, "=")
+	if !found {
+		return url.QueryEscape(value)
+	}
+	if name == "" {
+		return url.QueryEscape(content)
+	}
+	return name + "=" + url.QueryEscape(content)
+}
+
+// build a multipart body out of -F fields, "@path" uploads a file
+func curlMultipart(fields [][2]string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, field := range fields {
+		name, value := field[0], field[1]
+		if strings.HasPrefix(value, "@") {
+			path := strings.SplitN(value[1:], ";", 2)[0]
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, "", err
+			}
+			part, err := writer.CreateFormFile(name, path)
+			if err != nil {
+				return nil, "", err
+			}
+			part.Write(content)
+			continue
+		}
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), writer.FormDataContentType(), nil
+}
+
+// case insensitive header lookup on a header map
+func headerLookup(headers map[string]string, key string) (string, bool) {
+	for k, v := range headers {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// split a command line the way a posix shell would: quotes, backslash escapes and line continuations
+func shellSplit(command string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == '\\':
+			if i+1 < len(command) {
+				i++
+				// backslash newline is a line continuation
+				if command[i] != '\n' {
+					current.WriteByte(command[i])
+					inArg = true
+				}
+			}
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("curl: unterminated single quote")
+			}
+			current.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '"':
+			i++
+			for ; i < len(command) && command[i] != '"'; i++ {
+				// inside double quotes backslash only escapes these
+				if command[i] == '\\' && i+1 < len(command) && strings.IndexByte("\"\\$`\n", command[i+1]) >= 0 {
+					i++
+					if command[i] == '\n' {
+						continue
+					}
+				}
+				current.WriteByte(command[i])
+			}
+			if i >= len(command) {
+				return nil, fmt.Errorf("curl: unterminated double quote")
+			}
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,351 @@
+package http
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ------------------------------- ranged downloader -------------------------------
+
+// downloads large files straight to disk. when the server supports ranges the file is split into
+// parts fetched in parallel into a pre-allocated file, each part retried on its own. otherwise it
+// falls back to a single stream
+type Downloader struct {
+	Concurrency int                                 // parts fetched at once, default 4
+	PartSize    int64                               // bytes per part, default 8MB
+	MaxRetries  int                                 // retries of a failed part, default 3
+	Progress    func(downloaded int64, total int64) // called as bytes arrive (from several goroutines), total is -1 when unknown
+	headers     map[string]string
+	client      *HttpClient
+	algorithm   string
+	checksum    string
+}
+
+// create a downloader, headers are sent with every request
+func NewDownloader(headers map[string]string) *Downloader {
+	d := &Downloader{headers: make(map[string]string)}
+	for key, value := range headers {
+		d.headers[key] = value
+	}
+	return d
+}
+
+// send the requests through a configured client (its transport, timeout etc)
+func (d *Downloader) SetClient(client *HttpClient) {
+	d.client = client
+}
+
+// set a header sent with every request
+func (d *Downloader) SetHeader(key string, value string) {
+	d.headers[key] = value
+}
+
+// verify the finished file, algorithm is one of md5, sha1, sha256, sha512 and sum is hex encoded
+func (d *Downloader) SetChecksum(algorithm string, sum string) {
+	d.algorithm = strings.ToLower(algorithm)
+	d.checksum = strings.ToLower(sum)
+}
+
+// download url into path. the data goes to path+".part" first and is only renamed into place
+// once it is complete (and matches the checksum, when one is set)
+func (d *Downloader) Download(url string, path string) error {
+	hasher, err := d.hasher()
+	if err != nil {
+		return err
+	}
+
+	size, ranges, resp, err := d.probe(url)
+	if err != nil {
+		return err
+	}
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+
+	partPath := path + ".part"
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if ranges && size > 0 {
+		err = d.parallel(url, file, size)
+	} else {
+		err = d.single(url, file, resp)
+	}
+	if err == nil && hasher != nil {
+		err = d.verify(file, hasher)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	return os.Rename(partPath, path)
+}
+
+// size of the file and whether byte ranges are supported. size is -1 when unknown. a server that
+// ignores the range of the probe sends the whole file, that response is returned still open to be
+// used as the single stream download
+func (d *Downloader) probe(url string) (int64, bool, *http.Response, error) {
+	code, resp, err := d.request("HEAD", url).send("HEAD")
+	if err == nil && code >= 200 && code <= 299 {
+		size, err := strconv.ParseInt(resp.Headers["Content-Length"], 10, 64)
+		if err == nil && strings.Contains(resp.Headers["Accept-Ranges"], "bytes") {
+			return size, true, nil, nil
+		}
+	}
+
+	// HEAD is not always allowed or honest, ask for the first byte instead. streamed, a server
+	// ignoring the range must not end up buffered in memory
+	req := d.request("GET", url)
+	req.headers["Range"] = "bytes=0-0"
+	stream, err := d.httpClient().stream(context.Background(), req, "GET", url)
+	if err != nil {
+		return -1, false, nil, err
+	}
+	if stream.StatusCode == 206 {
+		stream.Body.Close()
+		// Content-Range: bytes 0-0/12345
+		if _, total, found := strings.Cut(stream.Header.Get("Content-Range"), "/"); found {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				return size, true, nil, nil
+			}
+		}
+		return -1, false, nil, nil
+	}
+	if stream.StatusCode < 200 || stream.StatusCode > 299 {
+		defer stream.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(stream.Body, 64<<10))
+		return -1, false, nil, &StatusError{StatusCode: stream.StatusCode, Body: body}
+	}
+	return stream.ContentLength, false, stream, nil
+}
+
+type downloadPart struct {
+	start int64
+	end   int64 // inclusive, like the Range header
+}
+
+// fetch all parts with a pool of workers, the first part that runs out of retries fails the download
+func (d *Downloader) parallel(url string, file *os.File, size int64) error {
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+
+	parts := make(chan downloadPart)
+	go func() {
+		defer close(parts)
+		for start := int64(0); start < size; start += d.partSize() {
+			end := start + d.partSize() - 1
+			if end >= size {
+				end = size - 1
+			}
+			parts <- downloadPart{start: start, end: end}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var downloaded int64
+	var once sync.Once
+	var failure error
+	var wg sync.WaitGroup
+	for i := 0; i < d.concurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range parts {
+				if ctx.Err() != nil {
+					continue // drain, the download already failed
+				}
+				err := d.fetchPart(ctx, url, file, part, func(n int64) {
+					d.progress(atomic.AddInt64(&downloaded, n), size)
+				})
+				if err != nil {
+					once.Do(func() {
+						failure = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return failure
+}
+
+// fetch one part, a retry continues from the last byte written
+func (d *Downloader) fetchPart(ctx context.Context, url string, file *os.File, part downloadPart, progress func(int64)) error {
+	offset := part.start
+	var err error
+	for attempt := 0; attempt <= d.maxRetries(); attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		var n int64
+		n, err = d.fetchRange(ctx, url, file, offset, part.end, progress)
+		offset += n
+		if err == nil && offset > part.end {
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("download: part %d-%d ended at %d", part.start, part.end, offset)
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// fetch bytes start-end into the file, returns how many bytes were written
+func (d *Downloader) fetchRange(ctx context.Context, url string, file *os.File, start int64, end int64, progress func(int64)) (int64, error) {
+	req := d.request("GET", url)
+	req.headers["Range"] = fmt.Sprintf("bytes=%d-%d", start, end)
+	resp, err := d.httpClient().stream(ctx, req, "GET", url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 206 {
+		return 0, fmt.Errorf("download: range request answered with status %d", resp.StatusCode)
+	}
+
+	writer := &offsetWriter{file: file, offset: start, progress: progress}
+	n, err := io.Copy(writer, io.LimitReader(resp.Body, end-start+1))
+	return n, err
+}
+
+// no ranges, one stream from the top. resp is the stream the probe already opened, if any
+func (d *Downloader) single(url string, file *os.File, resp *http.Response) error {
+	if resp == nil {
+		var err error
+		resp, err = d.httpClient().stream(context.Background(), d.request("GET", url), "GET", url)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("download: unexpected status %d", resp.StatusCode)
+	}
+
+	var downloaded int64
+	writer := &offsetWriter{file: file, progress: func(n int64) {
+		downloaded += n
+		d.progress(downloaded, resp.ContentLength)
+	}}
+	_, err := io.Copy(writer, resp.Body)
+	return err
+}
+
+func (d *Downloader) verify(file *os.File, hasher hash.Hash) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(hasher, file); err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if sum != d.checksum {
+		return fmt.Errorf("download: %s checksum mismatch, expected %s got %s", d.algorithm, d.checksum, sum)
+	}
+	return nil
+}
+
+func (d *Downloader) hasher() (hash.Hash, error) {
+	switch d.algorithm {
+	case "":
+		return nil, nil
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("download: unsupported checksum algorithm %q", d.algorithm)
+}
+
+func (d *Downloader) request(method string, url string) *HttpRequest {
+	req := &HttpRequest{Method: method, Url: url, headers: make(map[string]string), client: d.client}
+	for key, value := range d.headers {
+		req.headers[key] = value
+	}
+	return req
+}
+
+func (d *Downloader) httpClient() *HttpClient {
+	if d.client != nil {
+		return d.client
+	}
+	return defaultClient
+}
+
+func (d *Downloader) progress(downloaded int64, total int64) {
+	if d.Progress != nil {
+		d.Progress(downloaded, total)
+	}
+}
+
+func (d *Downloader) concurrency() int {
+	if d.Concurrency <= 0 {
+		return 4
+	}
+	return d.Concurrency
+}
+
+func (d *Downloader) partSize() int64 {
+	if d.PartSize <= 0 {
+		return 8 << 20
+	}
+	return d.PartSize
+}
+
+func (d *Downloader) maxRetries() int {
+	if d.MaxRetries <= 0 {
+		return 3
+	}
+	return d.MaxRetries
+}
+
+// writes sequentially into a file starting at an offset, safe next to other writers on other offsets
+type offsetWriter struct {
+	file     *os.File
+	offset   int64
+	progress func(int64)
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.file.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	if n > 0 && w.progress != nil {
+		w.progress(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,263 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ------------------------------- graphql client -------------------------------
+
+// a GraphQL client on top of HttpRequest, queries are POSTed as json
+type GraphQLClient struct {
+	Url       string
+	headers   map[string]string
+	client    *HttpClient
+	persisted bool
+}
+
+// one graphql operation
+type GraphQLRequest struct {
+	Query         string                 `json:"query,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// an entry of the "errors" list of a graphql response
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []GraphQLLocation      `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// all errors of one operation, returned next to whatever partial data could be decoded
+type GraphQLErrors []GraphQLError
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors GraphQLErrors   `json:"errors"`
+}
+
+// create a new graphql client, headers are sent with every operation
+func NewGraphQLClient(url string, headers map[string]string) *GraphQLClient {
+	g := &GraphQLClient{Url: url, headers: make(map[string]string)}
+	for key, value := range headers {
+		g.headers[key] = value
+	}
+	return g
+}
+
+// send the operations through a configured client (hedging, recording etc)
+func (g *GraphQLClient) SetClient(client *HttpClient) {
+	g.client = client
+}
+
+// set a header sent with every operation
+func (g *GraphQLClient) SetHeader(key string, value string) {
+	g.headers[key] = value
+}
+
+// send sha256 hashes instead of full query strings (automatic persisted queries).
+// the full query is only sent when the server does not know the hash yet
+func (g *GraphQLClient) SetPersistedQueries(enabled bool) {
+	g.persisted = enabled
+}
+
+// run a query or mutation and decode "data" into result (a pointer, or nil to discard it)
+func (g *GraphQLClient) Query(query string, variables map[string]interface{}, result interface{}) error {
+	return g.Do(GraphQLRequest{Query: query, Variables: variables}, result)
+}
+
+// run an operation and decode "data" into result. graphql errors come back as GraphQLErrors,
+// in which case result still holds any partial data
+func (g *GraphQLClient) Do(op GraphQLRequest, result interface{}) error {
+	if g.persisted {
+		var res graphQLResponse
+		err := g.post(persistedOnly(op), &res)
+		if err != nil {
+			return err
+		}
+		// the server has not seen this query yet, register it by sending it along with the hash
+		if !res.Errors.persistedQueryNotFound() {
+			return res.decode(result)
+		}
+		op = persisted(op)
+	}
+
+	var res graphQLResponse
+	err := g.post(op, &res)
+	if err != nil {
+		return err
+	}
+	return res.decode(result)
+}
+
+// send several operations in a single http request. results must line up with ops, the returned
+// slice holds the GraphQLErrors of each operation (nil when it succeeded)
+func (g *GraphQLClient) Batch(ops []GraphQLRequest, results []interface{}) ([]error, error) {
+	if len(results) != len(ops) {
+		return nil, fmt.Errorf("graphql: %d operations but %d results", len(ops), len(results))
+	}
+
+	payload := make([]GraphQLRequest, len(ops))
+	for i, op := range ops {
+		payload[i] = op
+		if g.persisted {
+			payload[i] = persisted(op)
+		}
+	}
+
+	var responses []graphQLResponse
+	if err := g.post(payload, &responses); err != nil {
+		return nil, err
+	}
+	if len(responses) != len(ops) {
+		return nil, fmt.Errorf("graphql: %d operations but %d responses", len(ops), len(responses))
+	}
+
+	errs := make([]error, len(ops))
+	for i, res := range responses {
+		errs[i] = res.decode(results[i])
+	}
+	return errs, nil
+}
+
+// post a payload and decode the graphql envelope(s) into out
+func (g *GraphQLClient) post(payload interface{}, out interface{}) error {
+	headers := map[string]string{"Content-Type": "application/json", "Accept": "application/json"}
+	for key, value := range g.headers {
+		headers[key] = value
+	}
+
+	req, err := NewHttpRequest("POST", g.Url, payload, headers)
+	if err != nil {
+		return err
+	}
+	if g.client != nil {
+		req.SetClient(g.client)
+	}
+
+	code, resp, err := req.Post()
+	if err != nil {
+		return err
+	}
+
+	// servers often answer validation errors with a 4xx and a normal graphql body, anything else
+	// off 2xx (a proxy's 502 page, {"message": ...}) is a plain status error
+	if code < 200 || code > 299 {
+		if err = json.Unmarshal(resp.Body, out); err != nil || !hasGraphQLErrors(out) {
+			return &StatusError{StatusCode: code, Body: resp.Body}
+		}
+		return nil
+	}
+	if err = json.Unmarshal(resp.Body, out); err != nil {
+		return fmt.Errorf("graphql: bad response: %v", err)
+	}
+	return nil
+}
+
+func hasGraphQLErrors(out interface{}) bool {
+	switch out := out.(type) {
+	case *graphQLResponse:
+		return len(out.Errors) > 0
+	case *[]graphQLResponse:
+		for _, res := range *out {
+			if len(res.Errors) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (res graphQLResponse) decode(result interface{}) error {
+	if result != nil && len(res.Data) > 0 && string(res.Data) != "null" {
+		if err := json.Unmarshal(res.Data, result); err != nil {
+			return fmt.Errorf("graphql: decode data: %v", err)
+		}
+	}
+	if len(res.Errors) > 0 {
+		return res.Errors
+	}
+	return nil
+}
+
+// ------------------------------- errors -------------------------------
+
+func (e GraphQLError) Error() string {
+	if len(e.Path) == 0 {
+		return "graphql: " + e.Message
+	}
+	path := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		path[i] = fmt.Sprint(p)
+	}
+	return fmt.Sprintf("graphql: %s (path: %s)", e.Message, strings.Join(path, "."))
+}
+
+// the "code" extension most servers set, eg UNAUTHENTICATED
+func (e GraphQLError) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+func (e GraphQLErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d graphql errors: %s", len(e), strings.Join(messages, "; "))
+}
+
+func (e GraphQLErrors) persistedQueryNotFound() bool {
+	for _, err := range e {
+		if err.Message == "PersistedQueryNotFound" || err.Code() == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
+
+// ------------------------------- persisted queries -------------------------------
+
+// the operation with the persisted query extension added
+func persisted(op GraphQLRequest) GraphQLRequest {
+	sum := sha256.Sum256([]byte(op.Query))
+	extensions := map[string]interface{}{}
+	for key, value := range op.Extensions {
+		extensions[key] = value
+	}
+	extensions["persistedQuery"] = map[string]interface{}{
+		"version":    1,
+		"sha256Hash": hex.EncodeToString(sum[:]),
+	}
+	op.Extensions = extensions
+	return op
+}
+
+// the hash only, without the query text
+func persistedOnly(op GraphQLRequest) GraphQLRequest {
+	op = persisted(op)
+	op.Query = ""
+	return op
+}
+
+// shorten a body for error messages
+func truncate(body []byte, max int) string {
+	if len(body) <= max {
+		return string(body)
+	}
+	return string(body[:max]) + "..."
+}
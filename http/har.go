@@ -0,0 +1,305 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ------------------------------- har recorder -------------------------------
+
+// records every exchange of a client in HTTP Archive (HAR 1.2) format, which loads straight
+// into the network tab of browser devtools. attach it with HttpClient.SetRecorder()
+type HarRecorder struct {
+	Redaction        *RedactionPolicy // base policy, default the package policy (see SetRedactionPolicy)
+	RedactHeaders    []string         // header names (any case) redacted on top of the policy
+	RedactBodyFields []string         // json paths redacted on top of the policy
+	RedactPatterns   []*regexp.Regexp // body patterns redacted on top of the policy
+	MaxBodySize      int              // bodies are truncated to this many bytes, 0 keeps them whole
+	MaxEntries       int              // only the newest entries are kept, 0 keeps everything
+
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+// create a recorder that redacts credentials and keeps bodies up to 1MB
+func NewHarRecorder() *HarRecorder {
+	return &HarRecorder{MaxBodySize: 1 << 20}
+}
+
+// number of recorded entries not flushed yet
+func (h *HarRecorder) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.entries)
+}
+
+// drop all recorded entries
+func (h *HarRecorder) Reset() {
+	h.mu.Lock()
+	h.entries = nil
+	h.mu.Unlock()
+}
+
+// write the recorded entries as a HAR document, the entries are kept
+func (h *HarRecorder) WriteTo(w io.Writer) (int64, error) {
+	h.mu.Lock()
+	entries := make([]harEntry, len(h.entries))
+	copy(entries, h.entries)
+	h.mu.Unlock()
+
+	data, err := harJSON(entries)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// write the recorded entries as a HAR document and forget them
+func (h *HarRecorder) Flush(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	data, err := harJSON(h.entries)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	h.entries = nil
+	return nil
+}
+
+// flush into a .har file, the file is overwritten
+func (h *HarRecorder) FlushToFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = h.Flush(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func harJSON(entries []harEntry) ([]byte, error) {
+	if entries == nil {
+		entries = []harEntry{}
+	}
+	return json.MarshalIndent(harDocument{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "goclient", Version: "1.0"},
+		Entries: entries,
+	}}, "", "  ")
+}
+
+// everything the client knows about one exchange
+type harExchange struct {
+	request      *http.Request
+	requestBody  []byte
+	response     *http.Response // nil when the request failed
+	responseBody []byte
+	err          error
+	trace        *timingTrace
+}
+
+func (h *HarRecorder) record(x harExchange) {
+	policy := h.policy()
+	entry := harEntry{
+		StartedDateTime: x.trace.start.Format(time.RFC3339Nano),
+		Time:            millis(time.Since(x.trace.start)),
+		Request: harRequest{
+			Method:      x.request.Method,
+			URL:         policy.URL(x.request.URL.String()),
+			HTTPVersion: x.request.Proto,
+			Cookies:     []harCookie{},
+			Headers:     harHeaders(policy, x.request.Header),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(x.requestBody),
+		},
+		Response: harResponse{
+			Cookies:     []harCookie{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Cache:   struct{}{},
+		Timings: x.trace.har(),
+	}
+
+	for key, values := range x.request.URL.Query() {
+		for _, value := range values {
+			if containsFold(policy.QueryParams, key) {
+				value = policy.mask()
+			}
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: key, Value: value})
+		}
+	}
+	if len(x.requestBody) > 0 {
+		text, _ := h.body(policy, x.requestBody)
+		entry.Request.PostData = &harPostData{MimeType: x.request.Header.Get("Content-Type"), Text: text}
+	}
+
+	if x.response != nil {
+		text, encoding := h.body(policy, x.responseBody)
+		entry.Response.Status = x.response.StatusCode
+		entry.Response.StatusText = http.StatusText(x.response.StatusCode)
+		entry.Response.HTTPVersion = x.response.Proto
+		entry.Response.Headers = harHeaders(policy, x.response.Header)
+		entry.Response.RedirectURL = x.response.Header.Get("Location")
+		entry.Response.BodySize = len(x.responseBody)
+		entry.Response.Content = harContent{
+			Size:     len(x.responseBody),
+			MimeType: x.response.Header.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		}
+		if h.MaxBodySize > 0 && len(x.responseBody) > h.MaxBodySize {
+			entry.Response.Content.Comment = fmt.Sprintf("truncated to %d bytes", h.MaxBodySize)
+		}
+	}
+	if x.err != nil {
+		entry.Error = x.err.Error()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, entry)
+	if h.MaxEntries > 0 && len(h.entries) > h.MaxEntries {
+		h.entries = h.entries[len(h.entries)-h.MaxEntries:]
+	}
+}
+
+// the package policy (or the recorder's own) plus the recorder's extra rules
+func (h *HarRecorder) policy() *RedactionPolicy {
+	policy := h.Redaction
+	if policy == nil {
+		policy = GetRedactionPolicy()
+	}
+	return policy.Extend(h.RedactHeaders, nil, h.RedactBodyFields, h.RedactPatterns)
+}
+
+func harHeaders(policy *RedactionPolicy, header http.Header) []harNameValue {
+	list := []harNameValue{}
+	for key, values := range header {
+		for _, value := range values {
+			list = append(list, harNameValue{Name: key, Value: policy.Header(key, value)})
+		}
+	}
+	return list
+}
+
+// redacted and size capped body text, binary bodies are base64 encoded
+func (h *HarRecorder) body(policy *RedactionPolicy, body []byte) (string, string) {
+	body = policy.Body(body)
+	if h.MaxBodySize > 0 && len(body) > h.MaxBodySize {
+		text := utf8.Valid(body)
+		body = body[:h.MaxBodySize]
+		// do not let the cut turn a text body into a binary one
+		for text && len(body) > 0 && !utf8.Valid(body) {
+			body = body[:len(body)-1]
+		}
+	}
+	if !utf8.Valid(body) {
+		return base64.StdEncoding.EncodeToString(body), "base64"
+	}
+	return string(body), ""
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// ------------------------------- har format -------------------------------
+
+type harDocument struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harCookie    `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harCookie    `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
@@ -0,0 +1,197 @@
+package http
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ------------------------------- hedging -------------------------------
+
+// hedging sends a duplicate of a slow idempotent request and takes whichever answers first.
+// the delay before a hedge is either fixed, or a percentile of the latencies seen so far
+type HedgePolicy struct {
+	Delay         time.Duration // fixed delay, also the fallback until enough latencies are sampled
+	Percentile    float64       // eg 0.95, hedge once a request is slower than 95% of the previous ones. 0 disables
+	MaxHedges     int           // max duplicates in flight next to the original request, default 1
+	AlternateURLs []string      // base urls the hedges go to (round robin), default is the original url
+	Methods       []string      // methods that are safe to hedge, default GET and HEAD
+
+	mu        sync.Mutex
+	latencies []time.Duration // ring buffer of recent latencies
+	next      int
+}
+
+const (
+	hedgeWindow     = 200 // latencies kept for the percentile
+	hedgeMinSamples = 20  // below this the fixed delay is used
+)
+
+// hedge after a fixed delay
+func NewHedgePolicy(delay time.Duration, maxHedges int) *HedgePolicy {
+	return &HedgePolicy{Delay: delay, MaxHedges: maxHedges}
+}
+
+// hedge once a request is slower than the given percentile (0-1) of recent requests,
+// fallback is used until enough requests have been seen
+func NewPercentileHedgePolicy(percentile float64, fallback time.Duration, maxHedges int) *HedgePolicy {
+	return &HedgePolicy{Delay: fallback, Percentile: percentile, MaxHedges: maxHedges}
+}
+
+func (p *HedgePolicy) applies(method string) bool {
+	methods := p.Methods
+	if len(methods) == 0 {
+		methods = []string{"GET", "HEAD"}
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *HedgePolicy) maxHedges() int {
+	if p.MaxHedges < 1 {
+		return 1
+	}
+	return p.MaxHedges
+}
+
+// how long to wait before sending the next hedge
+func (p *HedgePolicy) delay() time.Duration {
+	if p.Percentile <= 0 {
+		return p.Delay
+	}
+
+	p.mu.Lock()
+	if len(p.latencies) < hedgeMinSamples {
+		p.mu.Unlock()
+		return p.Delay
+	}
+	sorted := make([]time.Duration, len(p.latencies))
+	copy(sorted, p.latencies)
+	p.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := int(p.Percentile * float64(len(sorted)))
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
+
+func (p *HedgePolicy) observe(latency time.Duration) {
+	if p.Percentile <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.latencies) < hedgeWindow {
+		p.latencies = append(p.latencies, latency)
+		return
+	}
+	p.latencies[p.next] = latency
+	p.next = (p.next + 1) % hedgeWindow
+}
+
+// url for the n-th hedge (1 based), swaps scheme and host for an alternate base url when configured
+func (p *HedgePolicy) target(rawURL string, n int) string {
+	if len(p.AlternateURLs) == 0 {
+		return rawURL
+	}
+	return rebase(rawURL, p.AlternateURLs[(n-1)%len(p.AlternateURLs)])
+}
+
+// move a url onto another base url, keeping path and query. the base may carry a path prefix
+func rebase(rawURL string, base string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return rawURL
+	}
+	u.Scheme = b.Scheme
+	u.Host = b.Host
+	u.User = b.User
+	if prefix := strings.TrimSuffix(b.Path, "/"); prefix != "" {
+		u.Path = prefix + u.Path
+		u.RawPath = ""
+	}
+	return u.String()
+}
+
+type hedgeResult struct {
+	code int
+	resp HttpResponse
+	err  error
+}
+
+// a hedge result is good enough to win when the upstream answered and did not fail
+func (h hedgeResult) ok() bool {
+	return h.err == nil && h.code < 500
+}
+
+// send the original request, then a hedge every delay until one succeeds or MaxHedges is reached.
+// the first good answer wins and everything still in flight is cancelled
+func (c *HttpClient) hedged(ctx context.Context, r *HttpRequest, method string, url string) (int, HttpResponse, error) {
+	policy := c.hedge
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	total := policy.maxHedges() + 1
+	results := make(chan hedgeResult, total)
+	launch := func(n int) {
+		target := url
+		if n > 0 {
+			target = policy.target(url, n)
+		}
+		go func() {
+			start := time.Now()
+			code, resp, err := c.attempt(ctx, r, method, target)
+			result := hedgeResult{code: code, resp: resp, err: err}
+			if result.ok() {
+				policy.observe(time.Since(start))
+			}
+			results <- result
+		}()
+	}
+
+	launch(0)
+	sent, received := 1, 0
+	var first *hedgeResult
+	timer := time.NewTimer(policy.delay())
+	defer timer.Stop()
+
+	for received < sent {
+		select {
+		case result := <-results:
+			received++
+			if result.ok() {
+				return result.code, result.resp, result.err
+			}
+			if first == nil {
+				first = &result
+			}
+			// a failed attempt does not need to wait for the delay, hedge right away
+			if sent < total {
+				launch(sent)
+				sent++
+			}
+		case <-timer.C:
+			if sent < total {
+				launch(sent)
+				sent++
+				timer.Reset(policy.delay())
+			}
+		}
+	}
+
+	// nothing succeeded, report the first failure
+	return first.code, first.resp, first.err
+}
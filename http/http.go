@@ -4,18 +4,27 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 )
 
 // ------------------------------- models -------------------------------
 
-// this is a request object on which .Get() and .Post() methods are called
+// this is a request object on which .Get() and .Post() methods are called. the setters change it in
+// place, see Clone() for sharing one between goroutines. requests out of a RequestBuilder are read
+// only, their setters panic
 type HttpRequest struct {
-	Url     string
-	Method  string
-	headers map[string]string
-	body    []byte
+	Url      string
+	Method   string
+	headers  map[string]string
+	body     []byte
+	signer   Signer
+	client   *HttpClient
+	timing   bool
+	timeout  time.Duration
+	expected []int
+	frozen   bool // built by a RequestBuilder, see mutable()
 }
 
 // this is a response object which is returned by .Get() and .Post() methods
@@ -23,6 +32,7 @@ type HttpResponse struct {
 	StatusCode int
 	Body       []byte
 	Headers    map[string]string
+	Timing     *Timing // only set when timing was enabled on the request
 }
 
 // ------------------------------- constructor -------------------------------
@@ -34,18 +44,10 @@ func NewHttpRequestFromContext(method string, url string, body []byte, header ht
 	req.Method = method
 
 	// convert headers to map
-	req.headers = make(map[string]string)
-	for key, values := range header {
-		headerValue := ""
-		for _, v := range values {
-			headerValue += headerValue + v
-		}
-		req.headers[key] = headerValue
-	}
+	req.headers = headerMap(header)
 
 	req.body = body
 
-	fmt.Println()
 	return req, nil
 }
 
@@ -54,12 +56,15 @@ func NewHttpRequest(method string, url string, body any, header map[string]strin
 	req := &HttpRequest{}
 	req.Url = url
 	req.Method = method
-	req.headers = header
+	// copy the map, so the caller's map is never written to by SetHeader() and friends
+	req.headers = make(map[string]string, len(header))
+	for key, value := range header {
+		req.headers[key] = value
+	}
 	// conver map to json []byte
 	var err error
 	req.body, err = json.Marshal(body)
 	if err != nil {
-		fmt.Println("Error:", err)
 		return nil, err
 	}
 	return req, nil
@@ -69,6 +74,10 @@ func NewHttpRequest(method string, url string, body any, header map[string]strin
 
 // set header by key in the request
 func (req *HttpRequest) SetHeader(key string, value string) {
+	req.mutable()
+	if req.headers == nil {
+		req.headers = make(map[string]string)
+	}
 	req.headers[key] = value
 }
 
@@ -79,21 +88,66 @@ func (req *HttpRequest) GetHeader(key string) string {
 
 // delete header by key from the request
 func (req *HttpRequest) DeleteHeader(key string) {
+	req.mutable()
 	delete(req.headers, key)
 }
 
-// get the entire header map from the request
+// get a copy of the entire header map from the request
 func (req *HttpRequest) GetHeaders() map[string]string {
-	return req.headers
+	headers := make(map[string]string, len(req.headers))
+	for key, value := range req.headers {
+		headers[key] = value
+	}
+	return headers
 }
 
 // delete all headers from the request
 func (req *HttpRequest) DeleteHeaders() {
+	req.mutable()
 	req.headers = make(map[string]string)
 }
 
+// attach a signer, it is run on every send right before the request goes out
+func (req *HttpRequest) SetSigner(signer Signer) {
+	req.mutable()
+	req.signer = signer
+}
+
+// send this request through a configured client (hedging etc), instead of the default one
+func (req *HttpRequest) SetClient(client *HttpClient) {
+	req.mutable()
+	req.client = client
+}
+
+// collect a dns/connect/tls/ttfb breakdown into HttpResponse.Timing
+func (req *HttpRequest) SetTiming(enabled bool) {
+	req.mutable()
+	req.timing = enabled
+}
+
+// give up on the request after this long, hedges and all. 0 means no timeout
+func (req *HttpRequest) SetTimeout(timeout time.Duration) {
+	req.mutable()
+	req.timeout = timeout
+}
+
+// treat any other status code as an error (*StatusError). the response is still returned
+func (req *HttpRequest) SetExpectedStatus(codes ...int) {
+	req.mutable()
+	req.expected = codes
+}
+
+// a built request may be shared by any number of goroutines, changing it in place would leak into
+// all of them. a programming error like a concurrent map write, so it panics the same way
+func (req *HttpRequest) mutable() {
+	if req.frozen {
+		panic("http: request from RequestBuilder.Build() is read only, change a Clone() of it")
+	}
+}
+
 // load a structure into the request body
 func (req *HttpRequest) Encode(v any) error {
+	req.mutable()
 	var err error
 	req.body, err = json.Marshal(v)
 	if err != nil {
@@ -129,342 +183,78 @@ func (res *HttpResponse) GetHeaders() map[string]string {
 	return res.Headers
 }
 
-// --------------------------------- http methods ---------------------------------
-
-// make get request
-func (r *HttpRequest) Get(urls ...string) (int, HttpResponse, error) {
-	url := r.Url
-	if len(urls) == 1 {
-		url = urls[0]
-	}
+// ------------------------------- errors -------------------------------
 
-	// Create a new HTTP request with the provided JSON payload and headers
-	payloadJson, _ := json.Marshal(r.body)
-	payload := bytes.NewReader(payloadJson)
-	req, err := http.NewRequest("GET", url, payload)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
-	}
+// returned when the status code is not one of the expected ones, see SetExpectedStatus()
+type StatusError struct {
+	StatusCode int
+	Body       []byte
+}
 
-	// Set the request headers
-	for key, value := range r.headers {
-		req.Header.Set(key, value)
-	}
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, truncate(GetRedactionPolicy().Body(e.Body), 200))
+}
 
-	// Create a new HTTP client and send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
+func (req *HttpRequest) expects(code int) bool {
+	if len(req.expected) == 0 {
+		return true
 	}
-	defer resp.Body.Close()
-
-	// Convert the response headers into a map
-
-	ResponseHeaders := make(map[string]string)
-	for key, values := range resp.Header {
-		headerValue := ""
-		for _, v := range values {
-			headerValue += headerValue + v
+	for _, expected := range req.expected {
+		if code == expected {
+			return true
 		}
-		ResponseHeaders[key] = headerValue
-	}
-
-	// Read the response body into a []byte variable
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
 	}
+	return false
+}
 
-	// return this object
-	httpResponse := HttpResponse{}
-	httpResponse.StatusCode = resp.StatusCode
-	httpResponse.Body = body
-	httpResponse.Headers = ResponseHeaders
+// --------------------------------- http methods ---------------------------------
 
-	return resp.StatusCode, httpResponse, nil
+// make get request
+func (r *HttpRequest) Get(urls ...string) (int, HttpResponse, error) {
+	return r.send("GET", urls...)
 }
 
 // make post request
 func (r *HttpRequest) Post(urls ...string) (int, HttpResponse, error) {
-	url := r.Url
-	if len(urls) == 1 {
-		url = urls[0]
-	}
-
-	// Create a new HTTP request with the provided JSON payload and headers
-	payloadJson, _ := json.Marshal(r.body)
-	payload := bytes.NewReader(payloadJson)
-	req, err := http.NewRequest("POST", url, payload)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
-	}
-
-	// Set the request headers
-	for key, value := range r.headers {
-		req.Header.Set(key, value)
-	}
-
-	// Create a new HTTP client and send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
-	}
-	defer resp.Body.Close()
-
-	// Convert the response headers into a map
-
-	ResponseHeaders := make(map[string]string)
-	for key, values := range resp.Header {
-		headerValue := ""
-		for _, v := range values {
-			headerValue += headerValue + v
-		}
-		ResponseHeaders[key] = headerValue
-	}
-
-	// Read the response body into a []byte variable
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
-	}
-
-	// return this object
-	httpResponse := HttpResponse{}
-	httpResponse.StatusCode = resp.StatusCode
-	httpResponse.Body = body
-	httpResponse.Headers = ResponseHeaders
-
-	return resp.StatusCode, httpResponse, nil
+	return r.send("POST", urls...)
 }
 
 // make put request
 func (r *HttpRequest) Put(urls ...string) (int, HttpResponse, error) {
-	url := r.Url
-	if len(urls) == 1 {
-		url = urls[0]
-	}
-
-	// Create a new HTTP request with the provided JSON payload and headers
-	payloadJson, _ := json.Marshal(r.body)
-	payload := bytes.NewReader(payloadJson)
-	req, err := http.NewRequest("PUT", url, payload)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
-	}
-
-	// Set the request headers
-	for key, value := range r.headers {
-		req.Header.Set(key, value)
-	}
-
-	// Create a new HTTP client and send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
-	}
-	defer resp.Body.Close()
-
-	// Convert the response headers into a map
-
-	ResponseHeaders := make(map[string]string)
-	for key, values := range resp.Header {
-		headerValue := ""
-		for _, v := range values {
-			headerValue += headerValue + v
-		}
-		ResponseHeaders[key] = headerValue
-	}
-
-	// Read the response body into a []byte variable
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
-	}
-
-	// return this object
-	httpResponse := HttpResponse{}
-	httpResponse.StatusCode = resp.StatusCode
-	httpResponse.Body = body
-	httpResponse.Headers = ResponseHeaders
-
-	return resp.StatusCode, httpResponse, nil
+	return r.send("PUT", urls...)
 }
 
 // make patch request
 func (r *HttpRequest) Patch(urls ...string) (int, HttpResponse, error) {
-	url := r.Url
-	if len(urls) == 1 {
-		url = urls[0]
-	}
-
-	// Create a new HTTP request with the provided JSON payload and headers
-	payloadJson, _ := json.Marshal(r.body)
-	payload := bytes.NewReader(payloadJson)
-	req, err := http.NewRequest("PATCH", url, payload)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
-	}
-
-	// Set the request headers
-	for key, value := range r.headers {
-		req.Header.Set(key, value)
-	}
-
-	// Create a new HTTP client and send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
-	}
-	defer resp.Body.Close()
-
-	// Convert the response headers into a map
-
-	ResponseHeaders := make(map[string]string)
-	for key, values := range resp.Header {
-		headerValue := ""
-		for _, v := range values {
-			headerValue += headerValue + v
-		}
-		ResponseHeaders[key] = headerValue
-	}
-
-	// Read the response body into a []byte variable
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
-	}
-
-	// return this object
-	httpResponse := HttpResponse{}
-	httpResponse.StatusCode = resp.StatusCode
-	httpResponse.Body = body
-	httpResponse.Headers = ResponseHeaders
-
-	return resp.StatusCode, httpResponse, nil
+	return r.send("PATCH", urls...)
 }
 
 // make delete request
 func (r *HttpRequest) Delete(urls ...string) (int, HttpResponse, error) {
+	return r.send("DELETE", urls...)
+}
+
+// common path for all the http methods above
+func (r *HttpRequest) send(method string, urls ...string) (int, HttpResponse, error) {
 	url := r.Url
 	if len(urls) == 1 {
 		url = urls[0]
 	}
 
-	// Create a new HTTP request with the provided JSON payload and headers
-	payloadJson, _ := json.Marshal(r.body)
-	payload := bytes.NewReader(payloadJson)
-	req, err := http.NewRequest("DELETE", url, payload)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
-	}
-
-	// Set the request headers
-	for key, value := range r.headers {
-		req.Header.Set(key, value)
-	}
-
-	// Create a new HTTP client and send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
-	}
-	defer resp.Body.Close()
-
-	// Convert the response headers into a map
-
-	ResponseHeaders := make(map[string]string)
-	for key, values := range resp.Header {
-		headerValue := ""
-		for _, v := range values {
-			headerValue += headerValue + v
-		}
-		ResponseHeaders[key] = headerValue
-	}
-
-	// Read the response body into a []byte variable
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return -1, HttpResponse{}, err // the msg body becomes the error msg when response code is -1
+	client := r.client
+	if client == nil {
+		client = defaultClient
 	}
-
-	// return this object
-	httpResponse := HttpResponse{}
-	httpResponse.StatusCode = resp.StatusCode
-	httpResponse.Body = body
-	httpResponse.Headers = ResponseHeaders
-
-	return resp.StatusCode, httpResponse, nil
+	return client.do(r, method, url)
 }
 
-// ------------------------------ quick http functions -------------------------------
-// this is a function, not a method. This can be called directly to perform a quick post request
-func QuickHttpPOST(url string, postBody map[string]interface{}, bearerToken string) ([]byte, int, error) {
-	// Set the data to be sent to the API
-	payload, err := json.Marshal(postBody)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	// Make the API call using the POST method
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
-	if err != nil {
-		return nil, 0, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+bearerToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, resp.StatusCode, err
-	}
-
-	return body, resp.StatusCode, nil
-}
-
-func QuickHttpGET(url string, postBody map[string]interface{}, bearerToken string) ([]byte, int, error) {
-	// Set the data to be sent to the API
-	payload, err := json.Marshal(postBody)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	// Make the API call using the POST method
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
-	if err != nil {
-		return nil, 0, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+bearerToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, resp.StatusCode, err
+// convert http.Header into a flat map, multiple values of a header are joined with ", "
+func headerMap(header http.Header) map[string]string {
+	headers := make(map[string]string)
+	for key, values := range header {
+		headers[key] = strings.Join(values, ", ")
 	}
-
-	return body, resp.StatusCode, nil
+	return headers
 }
 
 /* ------------------------------------ Examples -------------------------------------
@@ -514,4 +304,185 @@ DELETE
 	fmt.Println("code: ", code)
 	fmt.Println("body: ", body)
 
+
+SIGNED REQUEST
+-----------------------------------------------------------------
+	httpRequest, _ := client.NewHttpRequest("PUT", "https://bucket.s3.amazonaws.com/report.json", report, map[string]string{})
+	httpRequest.SetSigner(client.NewSigV4Signer(accessKey, secretKey, "us-east-1", "s3"))
+	code, resp, err := httpRequest.Put()
+
+	// partner webhooks, signature of "timestamp.body" in X-Signature
+	signer := client.NewHMACSigner([]byte(secret))
+	signer.Canonicalize = client.TimestampBodyCanonical
+	httpRequest.SetSigner(signer)
+
+
+HEDGED GET
+-----------------------------------------------------------------
+	// duplicate a GET that takes longer than the p95 latency, to a second replica
+	httpClient := client.NewHttpClient()
+	policy := client.NewPercentileHedgePolicy(0.95, 100*time.Millisecond, 1)
+	policy.AlternateURLs = []string{"https://replica-2.internal"}
+	httpClient.SetHedgePolicy(policy)
+
+	httpRequest.SetClient(httpClient)
+	code, resp, err := httpRequest.Get()
+
+
+CURL
+-----------------------------------------------------------------
+	fmt.Println(httpRequest.CurlRedacted()) // paste into a bug report without leaking the token
+
+	httpRequest, err := client.NewHttpRequestFromCurl(`curl -X POST https://x.com/get-list -H 'Authorization: Bearer abc' -d '{"page":2}'`)
+	code, resp, err := httpRequest.Post()
+
+
+HAR RECORDING
+-----------------------------------------------------------------
+	recorder := client.NewHarRecorder()
+	recorder.RedactBodyFields = []string{"password", "otp"}
+	httpClient.SetRecorder(recorder)
+
+	// ... make requests with httpRequest.SetClient(httpClient) ...
+	recorder.FlushToFile("partner.har") // open in the devtools network tab
+
+
+TIMING
+-----------------------------------------------------------------
+	httpRequest.SetTiming(true)
+	code, resp, err := httpRequest.Get()
+	fmt.Println("dns:", resp.Timing.DNS, "ttfb:", resp.Timing.TimeToFirstByte, "reused:", resp.Timing.ConnReused)
+
+
+GRAPHQL
+-----------------------------------------------------------------
+	gql := client.NewGraphQLClient("https://api.x.com/graphql", map[string]string{"Authorization": "Bearer " + token})
+	var out struct {
+		User struct{ Name string } `json:"user"`
+	}
+	err := gql.Query(`query($id: ID!) { user(id: $id) { name } }`, map[string]interface{}{"id": 42}, &out)
+	if errs, ok := err.(client.GraphQLErrors); ok {
+		fmt.Println(errs[0].Path, errs[0].Code()) // out still holds the partial data
+	}
+
+
+JSON-RPC
+-----------------------------------------------------------------
+	rpc := client.NewJsonRpcClient("http://localhost:8545", nil)
+	var balance string
+	err := rpc.Call("eth_getBalance", []interface{}{address, "latest"}, &balance)
+	if rpcErr, ok := err.(*client.JsonRpcError); ok {
+		fmt.Println(rpcErr.Code, rpcErr.Message)
+	}
+
+	// batch, responses are matched by id whatever order they come back in
+	var block, gas string
+	calls := []*client.JsonRpcCall{{Method: "eth_blockNumber", Result: &block}, {Method: "eth_gasPrice", Result: &gas}}
+	err = rpc.Batch(calls) // per call errors end up in calls[i].Error
+
+
+QUICK CALLS
+-----------------------------------------------------------------
+	code, resp, err := client.Get("https://x.com/get-list",
+		client.WithQuery("page", "2"),
+		client.WithBearerToken(token),
+		client.WithTimeout(5*time.Second),
+		client.WithExpectedStatus(200),
+	)
+	if statusErr, ok := err.(*client.StatusError); ok {
+		fmt.Println("upstream said", statusErr.StatusCode)
+	}
+
+	code, resp, err = client.Post("https://x.com/get-otp", client.WithJSON(payload))
+
+
+BUILDER / DERIVED REQUESTS
+-----------------------------------------------------------------
+	// a template shared by all goroutines, never mutated
+	template := client.NewRequestBuilder("GET", "https://x.com/users").BearerToken(token).Timeout(5 * time.Second)
+
+	go func() {
+		httpRequest, err := template.Query("page", "2").Build()
+		code, resp, err := httpRequest.Send()
+	}()
+
+	// or derive from an existing request, the original stays untouched
+	tenantRequest := httpRequest.WithHeader("X-Tenant", tenant).WithQuery("page", "3")
+
+	// built requests are read only (SetHeader & co panic), change a clone of them instead
+	ownRequest := httpRequest.Clone()
+	ownRequest.SetHeader("X-Debug", "1")
+
+
+RESUMABLE UPLOAD (tus)
+-----------------------------------------------------------------
+	tus := client.NewTusClient("https://ingest.x.com/files/", map[string]string{"Authorization": "Bearer " + token})
+	tus.Checksum = true
+	tus.SetStore(client.NewTusRedisStore(&redisClient, "tus:", 24*60)) // or client.NewTusFileStore("uploads.json")
+
+	uploadURL, err := tus.UploadFile("/media/big.mp4", func(uploaded, total int64) {
+		fmt.Printf("%d/%d\n", uploaded, total)
+	})
+
+
+LARGE DOWNLOADS
+-----------------------------------------------------------------
+	downloader := client.NewDownloader(map[string]string{"Authorization": "Bearer " + token})
+	downloader.Concurrency = 8
+	downloader.SetChecksum("sha256", expectedSum)
+	err := downloader.Download("https://artifacts.x.com/build.tar.gz", "/tmp/build.tar.gz")
+
+
+LOAD BALANCING
+-----------------------------------------------------------------
+	balancer := client.NewBalancer(client.RoundRobin, "http://10.0.0.1:8080", "http://10.0.0.2:8080")
+	balancer.AddEndpoint("http://10.0.0.3:8080", 2) // weight only matters for client.Weighted
+
+	httpClient := client.NewHttpClient()
+	httpClient.SetBalancer(balancer)
+	balancer.StartHealthChecks("/healthz", 5*time.Second) // sent through httpClient
+	defer balancer.StopHealthChecks()
+	code, resp, err := client.Get("/api/v1/users", client.WithClient(httpClient)) // fails over on errors and 5xx
+
+
+REDACTION
+-----------------------------------------------------------------
+	// credentials are masked by default in logs, HAR files, CurlRedacted(), request.String() and errors.
+	// add your own rules on top of the defaults
+	policy := client.GetRedactionPolicy().Extend(
+		[]string{"X-Session"},      // headers
+		[]string{"sig"},            // query parameters
+		[]string{"$.user.ssn"},     // json paths ("password" alone matches at any depth)
+		[]*regexp.Regexp{regexp.MustCompile(`\b\d{16}\b`)}, // anything else in bodies, eg card numbers
+	)
+	client.SetRedactionPolicy(policy)
+
+	httpClient := client.NewHttpClient()
+	httpClient.SetLogger(log.Default()) // POST https://x.com/a?sig=REDACTED -> 201 in 35ms
+	fmt.Println(httpRequest)            // POST https://x.com/a {Authorization: REDACTED} {"password":"REDACTED"}
+
+
+OPENAPI VALIDATION
+-----------------------------------------------------------------
+	// ValidateWarn logs mismatches, ValidateEnforce fails with a *client.ValidationError
+	validator, err := client.NewOpenAPIValidatorFromFile("partner-api.yaml", client.ValidateEnforce)
+
+	httpClient := client.NewHttpClient()
+	httpClient.SetValidator(validator)
+	code, resp, err := client.Get("https://api.partner.com/v1/users/12", client.WithClient(httpClient))
+	// openapi: response 200 of GET https://api.partner.com/v1/users/12 does not match the spec:
+	//   response body doesn't match schema at $.items[1].qty: value must be an integer
+
+
+RECORD / REPLAY (tests)
+-----------------------------------------------------------------
+	// record once against the real upstream, commit testdata/users.yaml, replay offline from then on.
+	// credentials are masked by the redaction policy before anything is written
+	cassette, err := client.NewCassette("testdata/users.yaml", client.CassetteReplay) // or CassetteRecord, CassetteReplayOrRecord
+	cassette.Matchers = []client.CassetteMatcher{client.MatchMethod, client.MatchURL, client.MatchBody, client.MatchHeaders("X-Tenant")}
+
+	httpClient := client.NewHttpClient()
+	httpClient.SetTransport(cassette)
+	code, resp, err := client.Get("https://api.x.com/users/12", client.WithClient(httpClient)) // unmatched requests fail
+
 */
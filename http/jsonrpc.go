@@ -0,0 +1,214 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ------------------------------- json-rpc client -------------------------------
+
+// a JSON-RPC 2.0 client on top of HttpRequest
+type JsonRpcClient struct {
+	Url     string
+	headers map[string]string
+	client  *HttpClient
+	lastID  uint64
+}
+
+// one call of a batch, Result and Error are filled in once the batch returns
+type JsonRpcCall struct {
+	Method string
+	Params interface{} // array or object, nil for none
+	Result interface{} // pointer to decode the result into, nil to discard it
+	Error  error       // *JsonRpcError when the server returned an error object
+}
+
+// the error object of a json-rpc response
+type JsonRpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// standard error codes
+const (
+	JsonRpcParseError     = -32700
+	JsonRpcInvalidRequest = -32600
+	JsonRpcMethodNotFound = -32601
+	JsonRpcInvalidParams  = -32602
+	JsonRpcInternalError  = -32603
+)
+
+type jsonRpcRequest struct {
+	Version string      `json:"jsonrpc"`
+	ID      *uint64     `json:"id,omitempty"` // nil for notifications
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type jsonRpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *JsonRpcError   `json:"error"`
+}
+
+// create a new json-rpc client, headers are sent with every call
+func NewJsonRpcClient(url string, headers map[string]string) *JsonRpcClient {
+	c := &JsonRpcClient{Url: url, headers: make(map[string]string)}
+	for key, value := range headers {
+		c.headers[key] = value
+	}
+	return c
+}
+
+// send the calls through a configured client (hedging, recording etc)
+func (c *JsonRpcClient) SetClient(client *HttpClient) {
+	c.client = client
+}
+
+// set a header sent with every call
+func (c *JsonRpcClient) SetHeader(key string, value string) {
+	c.headers[key] = value
+}
+
+// call a method and decode its result into result (a pointer, or nil to discard it).
+// an error object in the response comes back as *JsonRpcError
+func (c *JsonRpcClient) Call(method string, params interface{}, result interface{}) error {
+	id := c.nextID()
+	body, err := c.post(jsonRpcRequest{Version: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	var res jsonRpcResponse
+	if err = json.Unmarshal(body, &res); err != nil {
+		return fmt.Errorf("jsonrpc: bad response: %v", err)
+	}
+	if res.Error == nil && jsonRpcID(res.ID) != strconv.FormatUint(id, 10) {
+		return fmt.Errorf("jsonrpc: response id %s does not match request id %d", res.ID, id)
+	}
+	return res.decode(result)
+}
+
+// send a notification, the server does not answer those
+func (c *JsonRpcClient) Notify(method string, params interface{}) error {
+	_, err := c.post(jsonRpcRequest{Version: "2.0", Method: method, Params: params})
+	return err
+}
+
+// send several calls in one http request. responses are matched to calls by id, so the order
+// the server answers in does not matter. the returned error is only set when the batch as a whole failed
+func (c *JsonRpcClient) Batch(calls []*JsonRpcCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	requests := make([]jsonRpcRequest, len(calls))
+	byID := make(map[string]*JsonRpcCall, len(calls))
+	for i, call := range calls {
+		id := c.nextID()
+		requests[i] = jsonRpcRequest{Version: "2.0", ID: &id, Method: call.Method, Params: call.Params}
+		byID[strconv.FormatUint(id, 10)] = call
+	}
+
+	body, err := c.post(requests)
+	if err != nil {
+		return err
+	}
+
+	// a server that cannot parse the batch answers with a single error object
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' {
+		var res jsonRpcResponse
+		if err = json.Unmarshal(body, &res); err != nil {
+			return fmt.Errorf("jsonrpc: bad response: %v", err)
+		}
+		if res.Error != nil {
+			return res.Error
+		}
+		return fmt.Errorf("jsonrpc: expected a batch response")
+	}
+
+	var responses []jsonRpcResponse
+	if err = json.Unmarshal(body, &responses); err != nil {
+		return fmt.Errorf("jsonrpc: bad response: %v", err)
+	}
+	for _, res := range responses {
+		call, ok := byID[jsonRpcID(res.ID)]
+		if !ok {
+			continue
+		}
+		call.Error = res.decode(call.Result)
+		delete(byID, jsonRpcID(res.ID))
+	}
+	for id, call := range byID {
+		call.Error = fmt.Errorf("jsonrpc: no response for call %s (%s)", id, call.Method)
+	}
+	return nil
+}
+
+func (c *JsonRpcClient) nextID() uint64 {
+	return atomic.AddUint64(&c.lastID, 1)
+}
+
+// post a payload and return the raw response body
+func (c *JsonRpcClient) post(payload interface{}) ([]byte, error) {
+	headers := map[string]string{"Content-Type": "application/json", "Accept": "application/json"}
+	for key, value := range c.headers {
+		headers[key] = value
+	}
+
+	req, err := NewHttpRequest("POST", c.Url, payload, headers)
+	if err != nil {
+		return nil, err
+	}
+	if c.client != nil {
+		req.SetClient(c.client)
+	}
+
+	code, resp, err := req.Post()
+	if err != nil {
+		return nil, err
+	}
+	// json-rpc over http answers errors with 200, but some servers use 4xx/5xx with an error object
+	if (code < 200 || code > 299) && !bytes.Contains(resp.Body, []byte(`"jsonrpc"`)) {
+		return nil, &StatusError{StatusCode: code, Body: resp.Body}
+	}
+	return resp.Body, nil
+}
+
+func (res jsonRpcResponse) decode(result interface{}) error {
+	if res.Error != nil {
+		return res.Error
+	}
+	if result != nil && len(res.Result) > 0 {
+		if err := json.Unmarshal(res.Result, result); err != nil {
+			return fmt.Errorf("jsonrpc: decode result: %v", err)
+		}
+	}
+	return nil
+}
+
+// ids are sent as numbers, but some servers echo them back as strings
+func jsonRpcID(raw json.RawMessage) string {
+	return strings.Trim(string(bytes.TrimSpace(raw)), `"`)
+}
+
+// ------------------------------- errors -------------------------------
+
+func (e *JsonRpcError) Error() string {
+	return fmt.Sprintf("jsonrpc: %s (code %d)", e.Message, e.Code)
+}
+
+// decode the optional data member of the error
+func (e *JsonRpcError) DecodeData(v interface{}) error {
+	if len(e.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(e.Data, v)
+}
@@ -0,0 +1,241 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// ------------------------------- openapi validation -------------------------------
+
+// what happens when a request or response does not match the spec
+type ValidationMode int
+
+const (
+	ValidateWarn    ValidationMode = iota // log the mismatch and carry on
+	ValidateEnforce                       // fail with a *ValidationError, a bad request is never sent
+)
+
+// checks requests and responses of an HttpClient against an OpenAPI 3 document. operations are
+// matched by method and path, the host of the spec servers is ignored (their path prefix is kept),
+// so the same spec works against staging and production. requests that match no operation pass
+type OpenAPIValidator struct {
+	Mode   ValidationMode
+	Logger *log.Logger // where warn mode writes to, default log.Default()
+
+	router routers.Router
+}
+
+// a request or response that does not match the spec
+type ValidationError struct {
+	Method     string
+	URL        string
+	StatusCode int      // 0 when the request failed validation
+	Problems   []string // eg `response body doesn't match schema at $.items[0].id: value must be an integer`
+}
+
+func (e *ValidationError) Error() string {
+	what := "request"
+	if e.StatusCode != 0 {
+		what = "response " + strconv.Itoa(e.StatusCode)
+	}
+	return fmt.Sprintf("openapi: %s of %s %s does not match the spec: %s", what, e.Method, GetRedactionPolicy().URL(e.URL), strings.Join(e.Problems, "; "))
+}
+
+// load a spec from yaml or json
+func NewOpenAPIValidator(spec []byte, mode ValidationMode) (*OpenAPIValidator, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(spec)
+	if err != nil {
+		return nil, err
+	}
+	return newOpenAPIValidator(loader, doc, mode)
+}
+
+// load a spec from a yaml or json file, relative $refs are resolved against its directory
+func NewOpenAPIValidatorFromFile(path string, mode ValidationMode) (*OpenAPIValidator, error) {
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+	doc, err := loader.LoadFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newOpenAPIValidator(loader, doc, mode)
+}
+
+func newOpenAPIValidator(loader *openapi3.Loader, doc *openapi3.T, mode ValidationMode) (*OpenAPIValidator, error) {
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("openapi: invalid spec: %w", err)
+	}
+	for _, server := range doc.Servers {
+		server.URL = serverPath(server.URL)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenAPIValidator{Mode: mode, router: router}, nil
+}
+
+// "https://{region}.x.com/v1" -> "/v1"
+func serverPath(serverURL string) string {
+	if _, rest, found := strings.Cut(serverURL, "://"); found {
+		serverURL = ""
+		if i := strings.Index(rest, "/"); i >= 0 {
+			serverURL = rest[i:]
+		}
+	}
+	if !strings.HasPrefix(serverURL, "/") {
+		serverURL = "/" + serverURL
+	}
+	return serverURL
+}
+
+// validate the request and any response against the spec, pass nil to turn validation off
+func (c *HttpClient) SetValidator(validator *OpenAPIValidator) {
+	c.validator = validator
+}
+
+// check the outgoing request. the returned input is needed to check the response, it is nil
+// when the request matches no operation
+func (v *OpenAPIValidator) request(ctx context.Context, r *HttpRequest, method string, url string) (*openapi3filter.RequestValidationInput, error) {
+	var body io.Reader
+	if hasBody(r.body) {
+		body = bytes.NewReader(r.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, nil // not ours to report, sending the request fails the same way
+	}
+	for key, value := range r.headers {
+		req.Header.Set(key, value)
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json") // what NewHttpRequest() encodes
+	}
+
+	route, params, err := v.router.FindRoute(req)
+	if err != nil {
+		return nil, nil
+	}
+	input := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: params,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			MultiError:            true,
+			IncludeResponseStatus: true,
+			AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+	if err := openapi3filter.ValidateRequest(ctx, input); err != nil {
+		return input, v.mismatch(&ValidationError{Method: method, URL: url, Problems: openAPIProblems("request", err)})
+	}
+	return input, nil
+}
+
+// check the response to a request that matched an operation
+func (v *OpenAPIValidator) response(ctx context.Context, input *openapi3filter.RequestValidationInput, resp HttpResponse) error {
+	header := http.Header{}
+	for key, value := range resp.Headers {
+		header.Set(key, value)
+	}
+	responseInput := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 resp.StatusCode,
+		Header:                 header,
+		Options:                input.Options,
+	}
+	responseInput.SetBodyBytes(resp.Body)
+	if err := openapi3filter.ValidateResponse(ctx, responseInput); err != nil {
+		return v.mismatch(&ValidationError{
+			Method:     input.Request.Method,
+			URL:        input.Request.URL.String(),
+			StatusCode: resp.StatusCode,
+			Problems:   openAPIProblems("response", err),
+		})
+	}
+	return nil
+}
+
+// log in warn mode, hand the error back in enforce mode
+func (v *OpenAPIValidator) mismatch(err *ValidationError) error {
+	if v.Mode == ValidateEnforce {
+		return err
+	}
+	logger := v.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Print(err)
+	return nil
+}
+
+// flatten kin-openapi errors into one line per problem, with json paths into the bodies
+func openAPIProblems(where string, err error) []string {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		problems := []string{}
+		for _, inner := range e {
+			problems = append(problems, openAPIProblems(where, inner)...)
+		}
+		return problems
+	case *openapi3filter.RequestError:
+		switch {
+		case e.Parameter != nil:
+			where = fmt.Sprintf("%s parameter %q", e.Parameter.In, e.Parameter.Name)
+			// kin-openapi quotes the offending value, keep credentials out of the message
+			policy := GetRedactionPolicy()
+			if containsFold(policy.QueryParams, e.Parameter.Name) || policy.RedactsHeader(e.Parameter.Name) {
+				return []string{where + ": invalid value"}
+			}
+		case e.RequestBody != nil:
+			where = "request body"
+		}
+		if e.Reason != "" && (e.Err == nil || e.Reason != e.Err.Error()) {
+			where += " " + e.Reason
+		}
+		if e.Err == nil {
+			return []string{where}
+		}
+		return openAPIProblems(where, e.Err)
+	case *openapi3filter.ResponseError:
+		reason := e.Reason
+		if reason == "status is not supported" {
+			reason = "status is not documented"
+		}
+		if !strings.HasPrefix(reason, "response") {
+			reason = "response " + reason
+		}
+		if e.Err == nil {
+			return []string{reason}
+		}
+		return openAPIProblems(reason, e.Err)
+	case *openapi3.SchemaError:
+		return []string{where + " at " + jsonPath(e.JSONPointer()) + ": " + e.Reason}
+	}
+	return []string{where + ": " + err.Error()}
+}
+
+// ["items", "0", "id"] -> $.items[0].id
+func jsonPath(pointer []string) string {
+	path := "$"
+	for _, segment := range pointer {
+		if _, err := strconv.Atoi(segment); err == nil {
+			path += "[" + segment + "]"
+		} else {
+			path += "." + segment
+		}
+	}
+	return path
+}
@@ -0,0 +1,255 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ------------------------------ quick http functions -------------------------------
+
+// these are functions, not methods. they build an HttpRequest from the options and send it right
+// away, so everything a request supports (signers, clients, timing ...) works the same here
+
+// an option of the quick http functions
+type Option func(req *HttpRequest) error
+
+// turns a value into a request body, returns the body and its content type
+type BodyEncoder func(v any) ([]byte, string, error)
+
+// quick get request
+func Get(url string, opts ...Option) (int, HttpResponse, error) {
+	return Do("GET", url, opts...)
+}
+
+// quick post request
+func Post(url string, opts ...Option) (int, HttpResponse, error) {
+	return Do("POST", url, opts...)
+}
+
+// quick put request
+func Put(url string, opts ...Option) (int, HttpResponse, error) {
+	return Do("PUT", url, opts...)
+}
+
+// quick patch request
+func Patch(url string, opts ...Option) (int, HttpResponse, error) {
+	return Do("PATCH", url, opts...)
+}
+
+// quick delete request
+func Delete(url string, opts ...Option) (int, HttpResponse, error) {
+	return Do("DELETE", url, opts...)
+}
+
+// quick head request
+func Head(url string, opts ...Option) (int, HttpResponse, error) {
+	return Do("HEAD", url, opts...)
+}
+
+// quick options request
+func Options(url string, opts ...Option) (int, HttpResponse, error) {
+	return Do("OPTIONS", url, opts...)
+}
+
+// quick request with any method
+func Do(method string, url string, opts ...Option) (int, HttpResponse, error) {
+	req := &HttpRequest{Method: strings.ToUpper(method), Url: url, headers: make(map[string]string)}
+	for _, opt := range opts {
+		if err := opt(req); err != nil {
+			return -1, HttpResponse{}, err
+		}
+	}
+	return req.send(req.Method)
+}
+
+// ------------------------------ options -------------------------------
+
+// set a header
+func WithHeader(key string, value string) Option {
+	return func(req *HttpRequest) error {
+		req.headers[key] = value
+		return nil
+	}
+}
+
+// set several headers
+func WithHeaders(headers map[string]string) Option {
+	return func(req *HttpRequest) error {
+		for key, value := range headers {
+			req.headers[key] = value
+		}
+		return nil
+	}
+}
+
+// add a query parameter to the url
+func WithQuery(key string, value string) Option {
+	return func(req *HttpRequest) error {
+		return req.addQuery(url.Values{key: {value}})
+	}
+}
+
+// add several query parameters to the url
+func WithQueryParams(params url.Values) Option {
+	return func(req *HttpRequest) error {
+		return req.addQuery(params)
+	}
+}
+
+// Authorization: Bearer <token>
+func WithBearerToken(token string) Option {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// Authorization: Basic <user:password>
+func WithBasicAuth(username string, password string) Option {
+	return WithHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+}
+
+// sign the request, see Signer
+func WithSigner(signer Signer) Option {
+	return func(req *HttpRequest) error {
+		req.signer = signer
+		return nil
+	}
+}
+
+// give up on the request after this long
+func WithTimeout(timeout time.Duration) Option {
+	return func(req *HttpRequest) error {
+		req.timeout = timeout
+		return nil
+	}
+}
+
+// any other status code is returned as a *StatusError
+func WithExpectedStatus(codes ...int) Option {
+	return func(req *HttpRequest) error {
+		req.expected = append([]int(nil), codes...)
+		return nil
+	}
+}
+
+// send through a configured client instead of the default one
+func WithClient(client *HttpClient) Option {
+	return func(req *HttpRequest) error {
+		req.client = client
+		return nil
+	}
+}
+
+// collect a timing breakdown into HttpResponse.Timing
+func WithTiming() Option {
+	return func(req *HttpRequest) error {
+		req.timing = true
+		return nil
+	}
+}
+
+// encode v with the given encoder as the request body, the content type is set unless already given
+func WithBody(v any, encoder BodyEncoder) Option {
+	return func(req *HttpRequest) error {
+		body, contentType, err := encoder(v)
+		if err != nil {
+			return err
+		}
+		req.body = body
+		if _, ok := headerLookup(req.headers, "Content-Type"); !ok && contentType != "" {
+			req.headers["Content-Type"] = contentType
+		}
+		return nil
+	}
+}
+
+// json request body
+func WithJSON(v any) Option {
+	return WithBody(v, JSONEncoder)
+}
+
+// url encoded form request body
+func WithForm(values url.Values) Option {
+	return WithBody(values, FormEncoder)
+}
+
+// send these exact bytes as the request body
+func WithRawBody(body []byte, contentType string) Option {
+	return WithBody(body, func(any) ([]byte, string, error) {
+		// every built request gets its own copy
+		return append([]byte(nil), body...), contentType, nil
+	})
+}
+
+// ------------------------------ encoders -------------------------------
+
+func JSONEncoder(v any) ([]byte, string, error) {
+	body, err := json.Marshal(v)
+	return body, "application/json", err
+}
+
+func XMLEncoder(v any) ([]byte, string, error) {
+	body, err := xml.Marshal(v)
+	return body, "application/xml", err
+}
+
+// takes url.Values or map[string]string
+func FormEncoder(v any) ([]byte, string, error) {
+	values := url.Values{}
+	switch t := v.(type) {
+	case url.Values:
+		values = t
+	case map[string]string:
+		for key, value := range t {
+			values.Set(key, value)
+		}
+	default:
+		return nil, "", fmt.Errorf("form encoder: unsupported type %T", v)
+	}
+	return []byte(values.Encode()), "application/x-www-form-urlencoded", nil
+}
+
+// add query params to the request url. the query already there is kept byte for byte (order and
+// escaping matter to signed urls), the new params are appended
+func (req *HttpRequest) addQuery(params url.Values) error {
+	u, err := url.Parse(req.Url)
+	if err != nil {
+		return err
+	}
+	encoded := params.Encode()
+	if encoded == "" {
+		return nil
+	}
+	if u.RawQuery != "" {
+		u.RawQuery += "&" + encoded
+	} else {
+		u.RawQuery = encoded
+	}
+	req.Url = u.String()
+	return nil
+}
+
+// ------------------------------ deprecated -------------------------------
+
+// Deprecated: use Post(url, WithJSON(postBody), WithBearerToken(bearerToken))
+func QuickHttpPOST(url string, postBody map[string]interface{}, bearerToken string) ([]byte, int, error) {
+	code, resp, err := Post(url, WithJSON(postBody), WithBearerToken(bearerToken))
+	if code == -1 {
+		code = 0
+	}
+	return resp.Body, code, err
+}
+
+// Deprecated: use Get(url, WithQuery(...), WithBearerToken(bearerToken)) for an actual GET.
+// despite its name this sends postBody as json in a POST, as it always did, so existing callers
+// keep working against the servers they were written for
+func QuickHttpGET(url string, postBody map[string]interface{}, bearerToken string) ([]byte, int, error) {
+	code, resp, err := Post(url, WithJSON(postBody), WithBearerToken(bearerToken))
+	if code == -1 {
+		code = 0
+	}
+	return resp.Body, code, err
+}
@@ -0,0 +1,266 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ------------------------------- redaction -------------------------------
+
+// what to hide whenever this package turns a request or response into text: logs, HAR files,
+// curl exports, request.String() and error messages
+type RedactionPolicy struct {
+	Headers     []string         // header names, any case
+	QueryParams []string         // query parameter names, any case
+	BodyFields  []string         // json paths, see below
+	Patterns    []*regexp.Regexp // matches are masked in any body, json or not
+	Mask        string           // replacement, default REDACTED
+
+	// body fields are dot separated json paths from the root ("user.ssn", "$.user.ssn"), where
+	// "*" or "[*]" matches any key or array element and "[0]" a single element. a plain name
+	// without dots ("password") matches that key at any depth
+}
+
+var redactionPolicy atomic.Pointer[RedactionPolicy]
+
+func init() {
+	redactionPolicy.Store(NewRedactionPolicy())
+}
+
+// a policy covering the usual credentials: auth and cookie headers, token style query
+// parameters and password/secret/token body fields
+func NewRedactionPolicy() *RedactionPolicy {
+	return &RedactionPolicy{
+		Headers: []string{
+			"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token",
+			"X-Amz-Security-Token",
+		},
+		QueryParams: []string{
+			"access_token", "token", "api_key", "apikey", "key", "password", "secret", "signature",
+			"X-Amz-Signature", "X-Amz-Credential", "X-Amz-Security-Token",
+		},
+		BodyFields: []string{"password", "secret", "token", "access_token", "refresh_token", "client_secret"},
+	}
+}
+
+// the policy used across the package
+func GetRedactionPolicy() *RedactionPolicy {
+	return redactionPolicy.Load()
+}
+
+// replace the policy used across the package, nil restores the default one
+func SetRedactionPolicy(policy *RedactionPolicy) {
+	if policy == nil {
+		policy = NewRedactionPolicy()
+	}
+	redactionPolicy.Store(policy)
+}
+
+// a copy of the policy with extra rules added, the policy itself is left alone
+func (p *RedactionPolicy) Extend(headers []string, queryParams []string, bodyFields []string, patterns []*regexp.Regexp) *RedactionPolicy {
+	extended := &RedactionPolicy{Mask: p.Mask}
+	extended.Headers = append(append([]string{}, p.Headers...), headers...)
+	extended.QueryParams = append(append([]string{}, p.QueryParams...), queryParams...)
+	extended.BodyFields = append(append([]string{}, p.BodyFields...), bodyFields...)
+	extended.Patterns = append(append([]*regexp.Regexp{}, p.Patterns...), patterns...)
+	return extended
+}
+
+func (p *RedactionPolicy) mask() string {
+	if p.Mask == "" {
+		return "REDACTED"
+	}
+	return p.Mask
+}
+
+// whether the header is on the deny list
+func (p *RedactionPolicy) RedactsHeader(name string) bool {
+	return containsFold(p.Headers, name)
+}
+
+// the header value, masked when the header is on the deny list
+func (p *RedactionPolicy) Header(name string, value string) string {
+	if p.RedactsHeader(name) {
+		return p.mask()
+	}
+	return value
+}
+
+// a redacted copy of a header map
+func (p *RedactionPolicy) HeaderMap(headers map[string]string) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		redacted[name] = p.Header(name, value)
+	}
+	return redacted
+}
+
+// the url with masked query parameters and any password in the user info masked
+func (p *RedactionPolicy) URL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), p.mask())
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		changed := false
+		for name, values := range query {
+			if containsFold(p.QueryParams, name) {
+				for i := range values {
+					values[i] = p.mask()
+				}
+				changed = true
+			}
+		}
+		if changed {
+			u.RawQuery = query.Encode()
+		}
+	}
+	return u.String()
+}
+
+// the body with json fields and patterns masked. bodies that are not json only get the patterns
+func (p *RedactionPolicy) Body(body []byte) []byte {
+	if len(p.BodyFields) > 0 {
+		body = p.redactJSON(body)
+	}
+	for _, pattern := range p.Patterns {
+		body = pattern.ReplaceAll(body, []byte(p.mask()))
+	}
+	return body
+}
+
+// a body without any of the fields comes back untouched. otherwise it is re-encoded: numbers
+// keep their digits (UseNumber) and html is not escaped, only the key order changes
+func (p *RedactionPolicy) redactJSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil || decoder.More() {
+		return body
+	}
+	masked := false
+	for _, field := range p.BodyFields {
+		segments := parseJSONPath(field)
+		if len(segments) == 1 && field == segments[0] {
+			doc = maskKeyAnywhere(doc, field, p.mask(), &masked)
+		} else {
+			doc = maskPath(doc, segments, p.mask(), &masked)
+		}
+	}
+	if !masked {
+		return body
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return body
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// "$.items[*].card" -> items, *, card
+func parseJSONPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.ReplaceAll(path, "[", ".")
+	path = strings.ReplaceAll(path, "]", "")
+	segments := []string{}
+	for _, segment := range strings.Split(path, ".") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+func maskKeyAnywhere(v interface{}, key string, mask string, masked *bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, value := range t {
+			if strings.EqualFold(k, key) {
+				t[k] = mask
+				*masked = true
+			} else {
+				t[k] = maskKeyAnywhere(value, key, mask, masked)
+			}
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = maskKeyAnywhere(t[i], key, mask, masked)
+		}
+	}
+	return v
+}
+
+func maskPath(v interface{}, segments []string, mask string, masked *bool) interface{} {
+	if len(segments) == 0 {
+		*masked = true
+		return mask
+	}
+	segment, rest := segments[0], segments[1:]
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, value := range t {
+			if segment == "*" || strings.EqualFold(k, segment) {
+				t[k] = maskPath(value, rest, mask, masked)
+			}
+		}
+	case []interface{}:
+		for i := range t {
+			if segment == "*" || segment == strconv.Itoa(i) {
+				t[i] = maskPath(t[i], rest, mask, masked)
+			}
+		}
+	}
+	return v
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ------------------------------- redacted views -------------------------------
+
+// one line description of the request, safe to log: "POST https://x.com/a {headers} body"
+func (req *HttpRequest) String() string {
+	policy := GetRedactionPolicy()
+	keys := make([]string, 0, len(req.headers))
+	for key := range req.headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	headers := make([]string, len(keys))
+	for i, key := range keys {
+		headers[i] = key + ": " + policy.Header(key, req.headers[key])
+	}
+
+	text := req.Method + " " + policy.URL(req.Url) + " {" + strings.Join(headers, ", ") + "}"
+	if hasBody(req.body) {
+		text += " " + truncate(policy.Body(req.body), 1024)
+	}
+	return text
+}
+
+// a redacted error, urls inside net/http errors have their query parameters masked
+func redactError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		urlErr.URL = GetRedactionPolicy().URL(urlErr.URL)
+	}
+	return err
+}
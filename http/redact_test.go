@@ -0,0 +1,25 @@
+package http
+
+import "testing"
+
+func TestRedactBodyUntouched(t *testing.T) {
+	policy := NewRedactionPolicy()
+	// no field to mask: the exact bytes come back, big integer, key order and html included
+	body := `{"id":12345678901234567891,"z":1,"a":"<b>"}`
+	if got := string(policy.Body([]byte(body))); got != body {
+		t.Errorf("got %s", got)
+	}
+	notJSON := `id=1&password=x`
+	if got := string(policy.Body([]byte(notJSON))); got != notJSON {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestRedactBodyMasked(t *testing.T) {
+	policy := NewRedactionPolicy().Extend(nil, nil, []string{"$.user.cards[*].number"}, nil)
+	body := `{"id":12345678901234567891,"html":"<b>","user":{"cards":[{"number":"4111","exp":"12/30"}],"password":"hunter2"}}`
+	want := `{"html":"<b>","id":12345678901234567891,"user":{"cards":[{"exp":"12/30","number":"REDACTED"}],"password":"REDACTED"}}`
+	if got := string(policy.Body([]byte(body))); got != want {
+		t.Errorf("\n got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,318 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------------- signer -------------------------------
+
+// a signer is attached to a request with SetSigner() and gets to modify the outgoing request
+// (usually by adding headers) right before it is sent. body is the exact payload being sent
+type Signer interface {
+	Sign(req *http.Request, body []byte) error
+}
+
+// ------------------------------- hmac signer -------------------------------
+
+// generic HMAC-SHA256 signer, the kind most webhook partners ask for
+type HMACSigner struct {
+	Key             []byte
+	Header          string                   // header carrying the signature, default X-Signature
+	Prefix          string                   // prepended to the signature value, eg "sha256="
+	TimestampHeader string                   // header carrying the timestamp, default X-Timestamp. "-" disables the timestamp
+	SignedHeaders   []string                 // request headers that are part of the canonical string
+	Base64          bool                     // base64 encode the signature instead of hex
+	Canonicalize    func(c Canonical) string // override the canonical string, default is DefaultCanonical
+	Now             func() time.Time         // clock, handy for fixed test vectors
+}
+
+// everything a canonicalization function gets to work with
+type Canonical struct {
+	Method    string
+	Path      string // escaped path
+	Query     string // escaped raw query
+	Timestamp string // empty when timestamps are disabled
+	Headers   []string
+	Body      []byte
+}
+
+// create a hmac signer with the default header names and canonicalization
+func NewHMACSigner(key []byte) *HMACSigner {
+	return &HMACSigner{Key: key}
+}
+
+// method, path, query, timestamp, "name:value" of every signed header and the body, joined by newlines
+func DefaultCanonical(c Canonical) string {
+	parts := []string{c.Method, c.Path, c.Query, c.Timestamp}
+	parts = append(parts, c.Headers...)
+	parts = append(parts, string(c.Body))
+	return strings.Join(parts, "\n")
+}
+
+// "timestamp.body", the stripe style canonicalization
+func TimestampBodyCanonical(c Canonical) string {
+	return c.Timestamp + "." + string(c.Body)
+}
+
+// just the body, for partners that sign the payload only
+func BodyCanonical(c Canonical) string {
+	return string(c.Body)
+}
+
+func (s *HMACSigner) Sign(req *http.Request, body []byte) error {
+	if len(s.Key) == 0 {
+		return fmt.Errorf("hmac signer: empty key")
+	}
+
+	c := Canonical{
+		Method: req.Method,
+		Path:   req.URL.EscapedPath(),
+		Query:  req.URL.RawQuery,
+		Body:   body,
+	}
+
+	// timestamp
+	timestampHeader := s.TimestampHeader
+	if timestampHeader == "" {
+		timestampHeader = "X-Timestamp"
+	}
+	if timestampHeader != "-" {
+		c.Timestamp = strconv.FormatInt(s.now().Unix(), 10)
+		req.Header.Set(timestampHeader, c.Timestamp)
+	}
+
+	// signed headers, in the order they were configured
+	for _, name := range s.SignedHeaders {
+		value := req.Header.Get(name)
+		if strings.EqualFold(name, "host") {
+			value = req.URL.Host
+		}
+		c.Headers = append(c.Headers, strings.ToLower(name)+":"+strings.TrimSpace(value))
+	}
+
+	canonicalize := s.Canonicalize
+	if canonicalize == nil {
+		canonicalize = DefaultCanonical
+	}
+
+	mac := hmacSHA256(s.Key, []byte(canonicalize(c)))
+	signature := hex.EncodeToString(mac)
+	if s.Base64 {
+		signature = base64.StdEncoding.EncodeToString(mac)
+	}
+
+	header := s.Header
+	if header == "" {
+		header = "X-Signature"
+	}
+	req.Header.Set(header, s.Prefix+signature)
+	return nil
+}
+
+func (s *HMACSigner) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// ------------------------------- aws signature v4 -------------------------------
+
+// AWS Signature Version 4 signer, works against S3 compatible storage and any other sigv4 service
+type SigV4Signer struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // optional, for temporary credentials
+	Region          string
+	Service         string
+	UnsignedPayload bool             // sign with UNSIGNED-PAYLOAD instead of hashing the body (s3 only)
+	Now             func() time.Time // clock, handy for fixed test vectors
+}
+
+const (
+	sigV4Algorithm   = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat  = "20060102T150405Z"
+	sigV4DateFormat  = "20060102"
+	sigV4Unsigned    = "UNSIGNED-PAYLOAD"
+	sigV4ContentHash = "X-Amz-Content-Sha256"
+)
+
+// create a sigv4 signer for the given credentials, region and service (eg "s3")
+func NewSigV4Signer(accessKeyID string, secretAccessKey string, region string, service string) *SigV4Signer {
+	return &SigV4Signer{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Region:          region,
+		Service:         service,
+	}
+}
+
+func (s *SigV4Signer) Sign(req *http.Request, body []byte) error {
+	if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+		return fmt.Errorf("sigv4 signer: missing credentials")
+	}
+
+	now := s.now().UTC()
+	amzDate := now.Format(sigV4TimeFormat)
+	date := now.Format(sigV4DateFormat)
+
+	// headers that are part of the signature
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	payloadHash := hex.EncodeToString(sha256Sum(body))
+	if s.UnsignedPayload {
+		payloadHash = sigV4Unsigned
+	}
+	if s.Service == "s3" {
+		req.Header.Set(sigV4ContentHash, payloadHash)
+	}
+
+	canonicalHeaders, signedHeaders := s.canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalURI(req.URL),
+		canonicalQuery(req.URL),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, s.Region, s.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n")
+
+	// derive the signing key
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), []byte(date))
+	key = hmacSHA256(key, []byte(s.Region))
+	key = hmacSHA256(key, []byte(s.Service))
+	key = hmacSHA256(key, []byte("aws4_request"))
+	signature := hex.EncodeToString(hmacSHA256(key, []byte(stringToSign)))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, s.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+func (s *SigV4Signer) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// s3 escapes the path once, every other service escapes the already escaped path again
+func (s *SigV4Signer) canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if s.Service == "s3" {
+		path = u.Path
+	}
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = sigV4Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// lowercase names, sorted, values trimmed with inner whitespace collapsed. host is always signed
+func (s *SigV4Signer) canonicalHeaders(req *http.Request) (string, string) {
+	values := map[string][]string{}
+	for name, vs := range req.Header {
+		values[strings.ToLower(name)] = vs
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values["host"] = []string{host}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		// user agent and friends are rewritten by proxies, never sign them
+		if name == "user-agent" || name == "authorization" || name == "content-length" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		trimmed := make([]string, len(values[name]))
+		for i, v := range values[name] {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		canonical.WriteString(name + ":" + strings.Join(trimmed, ",") + "\n")
+	}
+	return canonical.String(), strings.Join(names, ";")
+}
+
+// query params sorted by key then value, both escaped per rfc 3986
+func canonicalQuery(u *url.URL) string {
+	pairs := [][2]string{}
+	for key, vs := range u.Query() {
+		for _, v := range vs {
+			pairs = append(pairs, [2]string{sigV4Escape(key), sigV4Escape(v)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+
+	encoded := make([]string, len(pairs))
+	for i, pair := range pairs {
+		encoded[i] = pair[0] + "=" + pair[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+// rfc 3986 escaping, only unreserved characters are left alone
+func sigV4Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// ------------------------------- helpers -------------------------------
+
+func hmacSHA256(key []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// vectors from the aws sigv4 test suite
+// (https://docs.aws.amazon.com/general/latest/gr/signature-v4-test-suite.html)
+func TestSigV4TestSuite(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		signature string
+	}{
+		{"get-vanilla", "https://example.amazonaws.com/", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-query-order-key-case", "https://example.amazonaws.com/?Param2=value2&Param1=value1", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := NewSigV4Signer("AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service")
+			signer.Now = func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+
+			req, err := http.NewRequest("GET", tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := signer.Sign(req, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=" + tt.signature
+			if got := req.Header.Get("Authorization"); got != want {
+				t.Errorf("Authorization\n got %s\nwant %s", got, want)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %s", got)
+			}
+		})
+	}
+}
+
+// rfc 4231 test case 2, signing the body only
+func TestHMACSignerBodyVector(t *testing.T) {
+	signer := NewHMACSigner([]byte("Jefe"))
+	signer.TimestampHeader = "-"
+	signer.Canonicalize = BodyCanonical
+	signer.Prefix = "sha256="
+
+	req, _ := http.NewRequest("POST", "https://example.com/hooks", nil)
+	if err := signer.Sign(req, []byte("what do ya want for nothing?")); err != nil {
+		t.Fatal(err)
+	}
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got := req.Header.Get("X-Signature"); got != want {
+		t.Errorf("X-Signature = %s, want %s", got, want)
+	}
+	if req.Header.Get("X-Timestamp") != "" {
+		t.Error("timestamp header set although disabled")
+	}
+}
+
+// default canonical string, expected value from
+// printf 'POST\n/hooks\na=1\n1700000000\ncontent-type:application/json\n{"id":1}' | openssl dgst -sha256 -hmac secret
+func TestHMACSignerDefaultCanonical(t *testing.T) {
+	signer := NewHMACSigner([]byte("secret"))
+	signer.SignedHeaders = []string{"Content-Type"}
+	signer.Now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	req, _ := http.NewRequest("POST", "https://example.com/hooks?a=1", strings.NewReader(`{"id":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	if err := signer.Sign(req, []byte(`{"id":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("X-Timestamp"); got != "1700000000" {
+		t.Errorf("X-Timestamp = %s", got)
+	}
+	want := "481c7227e51a379d6168eeb0039c72cef309934497ac3ce21b932ae46cf5cac3"
+	if got := req.Header.Get("X-Signature"); got != want {
+		t.Errorf("X-Signature = %s, want %s", got, want)
+	}
+}
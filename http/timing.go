@@ -0,0 +1,144 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ------------------------------- timing -------------------------------
+
+// latency breakdown of a single request, enable it with HttpRequest.SetTiming(true).
+// phases that did not happen (eg dns and connect on a reused connection) are 0
+type Timing struct {
+	DNS             time.Duration // dns lookup
+	Connect         time.Duration // tcp connect
+	TLS             time.Duration // tls handshake
+	TimeToFirstByte time.Duration // from the start of the request until the first response byte
+	Total           time.Duration // from the start of the request until the body was read
+	ConnReused      bool          // the connection came out of the pool
+}
+
+// collects the httptrace callbacks of one request. callbacks may fire from
+// different goroutines (eg parallel dials), hence the lock
+type timingTrace struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	done         time.Time
+	reused       bool
+}
+
+func newTimingTrace() *timingTrace {
+	return &timingTrace{start: time.Now()}
+}
+
+// attach the trace to a request context
+func (t *timingTrace) context(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			// keep the first dial when several addresses are tried
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_ string, _ string, err error) {
+			if err == nil {
+				t.mark(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.mark(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.gotConn = time.Now()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+	})
+}
+
+func (t *timingTrace) mark(at *time.Time) {
+	t.mu.Lock()
+	*at = time.Now()
+	t.mu.Unlock()
+}
+
+// call once the response body has been read
+func (t *timingTrace) finish() {
+	t.mark(&t.done)
+}
+
+func (t *timingTrace) timing() *Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &Timing{
+		DNS:             between(t.dnsStart, t.dnsDone),
+		Connect:         between(t.connectStart, t.connectDone),
+		TLS:             between(t.tlsStart, t.tlsDone),
+		TimeToFirstByte: between(t.start, t.firstByte),
+		Total:           between(t.start, t.done),
+		ConnReused:      t.reused,
+	}
+}
+
+// the same trace in HAR terms, in milliseconds. HAR counts the tls handshake into connect
+func (t *timingTrace) har() harTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timings := harTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1}
+	if !t.dnsStart.IsZero() {
+		timings.DNS = millis(between(t.dnsStart, t.dnsDone))
+	}
+	if !t.connectStart.IsZero() {
+		end := t.connectDone
+		if t.tlsDone.After(end) {
+			end = t.tlsDone
+		}
+		timings.Connect = millis(between(t.connectStart, end))
+	}
+	if !t.tlsStart.IsZero() {
+		timings.SSL = millis(between(t.tlsStart, t.tlsDone))
+	}
+	if !t.gotConn.IsZero() {
+		blocked := between(t.start, t.gotConn)
+		if timings.DNS > 0 {
+			blocked -= between(t.dnsStart, t.dnsDone)
+		}
+		if timings.Connect > 0 {
+			blocked -= between(t.connectStart, t.gotConn)
+		}
+		if blocked < 0 {
+			blocked = 0
+		}
+		timings.Blocked = millis(blocked)
+	}
+	timings.Send = millis(between(t.gotConn, t.wroteRequest))
+	timings.Wait = millis(between(t.wroteRequest, t.firstByte))
+	timings.Receive = millis(between(t.firstByte, t.done))
+	return timings
+}
+
+// duration between two marks, 0 when either of them never happened
+func between(from time.Time, to time.Time) time.Duration {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return to.Sub(from)
+}
@@ -0,0 +1,461 @@
+package http
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ------------------------------- tus client -------------------------------
+
+// a tus 1.0 (https://tus.io) client for resumable uploads. uploads are created with a POST to the
+// endpoint and then sent in PATCH chunks. with a store attached, an interrupted upload of the same
+// file picks up where it stopped instead of starting over
+type TusClient struct {
+	Endpoint   string
+	ChunkSize  int64 // bytes per PATCH, default 4MB
+	Checksum   bool  // send an Upload-Checksum (sha1) with every chunk
+	MaxRetries int   // retries of a failed chunk, default 3
+	headers    map[string]string
+	client     *HttpClient
+	store      TusStore
+}
+
+// something to upload. Fingerprint identifies the content across restarts, leave it empty to disable resuming
+type TusUpload struct {
+	Reader      io.ReadSeeker
+	Size        int64
+	Metadata    map[string]string // sent as Upload-Metadata, eg filename and filetype
+	Fingerprint string
+}
+
+// called after every chunk with the bytes uploaded so far
+type TusProgress func(uploaded int64, total int64)
+
+const tusVersion = "1.0.0"
+
+// create a tus client for the given creation endpoint, headers are sent with every request
+func NewTusClient(endpoint string, headers map[string]string) *TusClient {
+	t := &TusClient{Endpoint: endpoint, headers: make(map[string]string)}
+	for key, value := range headers {
+		t.headers[key] = value
+	}
+	return t
+}
+
+// send the requests through a configured client
+func (t *TusClient) SetClient(client *HttpClient) {
+	t.client = client
+}
+
+// set a header sent with every request
+func (t *TusClient) SetHeader(key string, value string) {
+	t.headers[key] = value
+}
+
+// remember upload urls by fingerprint, so uploads can resume after a restart
+func (t *TusClient) SetStore(store TusStore) {
+	t.store = store
+}
+
+// describe a local file as an upload. the fingerprint covers path, size and modification time.
+// the caller closes the returned file once the upload is done
+func NewTusUploadFromFile(path string) (*TusUpload, *os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d", path, info.Size(), info.ModTime().UnixNano())))
+	upload := &TusUpload{
+		Reader:      file,
+		Size:        info.Size(),
+		Metadata:    map[string]string{"filename": info.Name()},
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}
+	return upload, file, nil
+}
+
+// upload a local file, resuming a previous attempt when the store knows it. returns the upload url
+func (t *TusClient) UploadFile(path string, progress TusProgress) (string, error) {
+	return t.UploadFileContext(context.Background(), path, progress)
+}
+
+func (t *TusClient) UploadFileContext(ctx context.Context, path string, progress TusProgress) (string, error) {
+	upload, file, err := NewTusUploadFromFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return t.UploadContext(ctx, upload, progress)
+}
+
+// upload everything, resuming a previous attempt when the store knows the fingerprint. returns the upload url
+func (t *TusClient) Upload(upload *TusUpload, progress TusProgress) (string, error) {
+	return t.UploadContext(context.Background(), upload, progress)
+}
+
+// Upload() until done or ctx is cancelled. a cancelled upload keeps its url in the store and
+// resumes on the next call
+func (t *TusClient) UploadContext(ctx context.Context, upload *TusUpload, progress TusProgress) (string, error) {
+	uploadURL, offset, err := t.resume(ctx, upload)
+	if err != nil {
+		return "", err
+	}
+	if uploadURL == "" {
+		uploadURL, err = t.create(ctx, upload)
+		if err != nil {
+			return "", err
+		}
+		offset = 0
+	}
+
+	if progress != nil {
+		progress(offset, upload.Size)
+	}
+
+	retries := 0
+	for offset < upload.Size {
+		next, err := t.patch(ctx, uploadURL, upload, offset)
+		if err == errTusShortRead {
+			return uploadURL, fmt.Errorf("tus: reader ended at %d of %d bytes", offset, upload.Size)
+		}
+		if err != nil {
+			if retries >= t.maxRetries() || ctx.Err() != nil {
+				return uploadURL, err
+			}
+			retries++
+			select {
+			case <-ctx.Done():
+				return uploadURL, ctx.Err()
+			case <-time.After(time.Duration(retries) * time.Second):
+			}
+			// ask the server how much it actually got before trying again
+			if next, err = t.offset(ctx, uploadURL); err != nil {
+				return uploadURL, err
+			}
+		} else if next <= offset {
+			// a server that takes the chunk without moving on would keep us here forever
+			return uploadURL, fmt.Errorf("tus: offset stuck at %d after a chunk", offset)
+		} else {
+			retries = 0
+		}
+		offset = next
+		if progress != nil {
+			progress(offset, upload.Size)
+		}
+	}
+
+	if t.store != nil && upload.Fingerprint != "" {
+		t.store.Delete(upload.Fingerprint)
+	}
+	return uploadURL, nil
+}
+
+// create a new upload on the server and return its url
+func (t *TusClient) Create(upload *TusUpload) (string, error) {
+	return t.create(context.Background(), upload)
+}
+
+func (t *TusClient) create(ctx context.Context, upload *TusUpload) (string, error) {
+	req := t.request("POST", t.Endpoint, nil)
+	req.headers["Upload-Length"] = strconv.FormatInt(upload.Size, 10)
+	if len(upload.Metadata) > 0 {
+		req.headers["Upload-Metadata"] = tusMetadata(upload.Metadata)
+	}
+
+	code, resp, err := t.send(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if code != 201 {
+		return "", fmt.Errorf("tus: create upload: %w", &StatusError{StatusCode: code, Body: resp.Body})
+	}
+
+	location := resp.Headers["Location"]
+	if location == "" {
+		return "", fmt.Errorf("tus: create upload: no Location header")
+	}
+	// the location may be relative to the endpoint
+	base, err := url.Parse(t.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	uploadURL := base.ResolveReference(ref).String()
+
+	if t.store != nil && upload.Fingerprint != "" {
+		if err = t.store.Set(upload.Fingerprint, uploadURL); err != nil {
+			return "", err
+		}
+	}
+	return uploadURL, nil
+}
+
+// the offset the server has for an upload
+func (t *TusClient) Offset(uploadURL string) (int64, error) {
+	return t.offset(context.Background(), uploadURL)
+}
+
+func (t *TusClient) offset(ctx context.Context, uploadURL string) (int64, error) {
+	code, resp, err := t.send(ctx, t.request("HEAD", uploadURL, nil))
+	if err != nil {
+		return 0, err
+	}
+	if code != 200 && code != 204 {
+		return 0, &StatusError{StatusCode: code, Body: resp.Body}
+	}
+	return strconv.ParseInt(resp.Headers["Upload-Offset"], 10, 64)
+}
+
+// cancel an upload on the server (termination extension)
+func (t *TusClient) Terminate(uploadURL string) error {
+	code, resp, err := t.request("DELETE", uploadURL, nil).Delete()
+	if err != nil {
+		return err
+	}
+	if code != 204 {
+		return &StatusError{StatusCode: code, Body: resp.Body}
+	}
+	return nil
+}
+
+// url and offset of a previous upload of the same content, empty url when there is nothing to resume
+func (t *TusClient) resume(ctx context.Context, upload *TusUpload) (string, int64, error) {
+	if t.store == nil || upload.Fingerprint == "" {
+		return "", 0, nil
+	}
+	uploadURL, ok, err := t.store.Get(upload.Fingerprint)
+	if err != nil || !ok {
+		return "", 0, err
+	}
+	offset, err := t.offset(ctx, uploadURL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", 0, ctx.Err()
+		}
+		// expired or unknown to the server (404/410), start over
+		t.store.Delete(upload.Fingerprint)
+		return "", 0, nil
+	}
+	return uploadURL, offset, nil
+}
+
+// the reader returned less than Size promised, retrying can not help
+var errTusShortRead = errors.New("tus: short read")
+
+// send one chunk starting at offset, returns the new offset
+func (t *TusClient) patch(ctx context.Context, uploadURL string, upload *TusUpload, offset int64) (int64, error) {
+	if _, err := upload.Reader.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	chunk, err := ioutil.ReadAll(io.LimitReader(upload.Reader, t.chunkSize()))
+	if err != nil {
+		return offset, err
+	}
+	if len(chunk) == 0 {
+		return offset, errTusShortRead
+	}
+
+	req := t.request("PATCH", uploadURL, chunk)
+	req.headers["Upload-Offset"] = strconv.FormatInt(offset, 10)
+	req.headers["Content-Type"] = "application/offset+octet-stream"
+	if t.Checksum {
+		sum := sha1.Sum(chunk)
+		req.headers["Upload-Checksum"] = "sha1 " + base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	code, resp, err := t.send(ctx, req)
+	if err != nil {
+		return offset, err
+	}
+	if code != 204 {
+		return offset, &StatusError{StatusCode: code, Body: resp.Body}
+	}
+	next, err := strconv.ParseInt(resp.Headers["Upload-Offset"], 10, 64)
+	if err != nil {
+		return offset, fmt.Errorf("tus: bad Upload-Offset %q", resp.Headers["Upload-Offset"])
+	}
+	return next, nil
+}
+
+func (t *TusClient) request(method string, uploadURL string, body []byte) *HttpRequest {
+	req := &HttpRequest{Method: method, Url: uploadURL, headers: make(map[string]string), body: body, client: t.client}
+	for key, value := range t.headers {
+		req.headers[key] = value
+	}
+	req.headers["Tus-Resumable"] = tusVersion
+	return req
+}
+
+func (t *TusClient) send(ctx context.Context, req *HttpRequest) (int, HttpResponse, error) {
+	client := t.client
+	if client == nil {
+		client = defaultClient
+	}
+	return client.doContext(ctx, req, req.Method, req.Url)
+}
+
+func (t *TusClient) chunkSize() int64 {
+	if t.ChunkSize <= 0 {
+		return 4 << 20
+	}
+	return t.ChunkSize
+}
+
+func (t *TusClient) maxRetries() int {
+	if t.MaxRetries <= 0 {
+		return 3
+	}
+	return t.MaxRetries
+}
+
+// "key base64(value),key base64(value)", sorted for stable output
+func tusMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + " " + base64.StdEncoding.EncodeToString([]byte(metadata[key]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// ------------------------------- stores -------------------------------
+
+// remembers upload urls by fingerprint
+type TusStore interface {
+	Get(fingerprint string) (string, bool, error)
+	Set(fingerprint string, uploadURL string) error
+	Delete(fingerprint string) error
+}
+
+// keeps upload urls in a json file
+type TusFileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewTusFileStore(path string) *TusFileStore {
+	return &TusFileStore{path: path}
+}
+
+func (s *TusFileStore) Get(fingerprint string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uploads, err := s.load()
+	if err != nil {
+		return "", false, err
+	}
+	uploadURL, ok := uploads[fingerprint]
+	return uploadURL, ok, nil
+}
+
+func (s *TusFileStore) Set(fingerprint string, uploadURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uploads, err := s.load()
+	if err != nil {
+		return err
+	}
+	uploads[fingerprint] = uploadURL
+	return s.save(uploads)
+}
+
+func (s *TusFileStore) Delete(fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uploads, err := s.load()
+	if err != nil {
+		return err
+	}
+	delete(uploads, fingerprint)
+	return s.save(uploads)
+}
+
+func (s *TusFileStore) load() (map[string]string, error) {
+	uploads := map[string]string{}
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return uploads, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return uploads, nil
+	}
+	return uploads, json.Unmarshal(data, &uploads)
+}
+
+func (s *TusFileStore) save(uploads map[string]string) error {
+	data, err := json.Marshal(uploads)
+	if err != nil {
+		return err
+	}
+	// write and rename, so a crash never leaves a half written file behind
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// the subset of the redis package's RedisClient a TusRedisStore needs
+type TusKeyValue interface {
+	Set(key string, value string, minutes ...uint16) bool
+	Get(key string) (string, bool)
+	Unset(key string) error
+}
+
+// keeps upload urls in redis, pass a *redis.RedisClient from this module
+type TusRedisStore struct {
+	kv      TusKeyValue
+	prefix  string
+	minutes uint16
+}
+
+// keys are prefix+fingerprint and expire after ttlMinutes (0 keeps them until the upload finishes)
+func NewTusRedisStore(kv TusKeyValue, prefix string, ttlMinutes uint16) *TusRedisStore {
+	return &TusRedisStore{kv: kv, prefix: prefix, minutes: ttlMinutes}
+}
+
+func (s *TusRedisStore) Get(fingerprint string) (string, bool, error) {
+	uploadURL, ok := s.kv.Get(s.prefix + fingerprint)
+	return uploadURL, ok, nil
+}
+
+func (s *TusRedisStore) Set(fingerprint string, uploadURL string) error {
+	if !s.kv.Set(s.prefix+fingerprint, uploadURL, s.minutes) {
+		return fmt.Errorf("tus: could not store upload url in redis")
+	}
+	return nil
+}
+
+func (s *TusRedisStore) Delete(fingerprint string) error {
+	return s.kv.Unset(s.prefix + fingerprint)
+}
@@ -0,0 +1,203 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// minimal tus server: creation, HEAD and PATCH. from the failFrom-th PATCH on (counted from 1,
+// 0 never) every PATCH answers 500 without storing anything
+type tusTestServer struct {
+	mu       sync.Mutex
+	uploads  map[string][]byte
+	posts    int
+	patches  int
+	failFrom int
+	stall    bool // answer PATCH without moving the offset
+}
+
+func newTusTestServer() (*tusTestServer, *httptest.Server) {
+	ts := &tusTestServer{uploads: make(map[string][]byte)}
+	return ts, httptest.NewServer(ts)
+}
+
+func (ts *tusTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.WriteHeader(412)
+		return
+	}
+	switch r.Method {
+	case "POST":
+		ts.posts++
+		id := fmt.Sprintf("/files/%d", ts.posts)
+		ts.uploads[id] = []byte{}
+		w.Header().Set("Location", id)
+		w.WriteHeader(201)
+	case "HEAD":
+		data, ok := ts.uploads[r.URL.Path]
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(data)))
+		w.WriteHeader(200)
+	case "PATCH":
+		ts.patches++
+		data, ok := ts.uploads[r.URL.Path]
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		if ts.failFrom > 0 && ts.patches >= ts.failFrom {
+			w.WriteHeader(500)
+			return
+		}
+		if r.Header.Get("Upload-Offset") != strconv.Itoa(len(data)) {
+			w.WriteHeader(409)
+			return
+		}
+		if !ts.stall {
+			chunk, _ := ioutil.ReadAll(r.Body)
+			data = append(data, chunk...)
+			ts.uploads[r.URL.Path] = data
+		}
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(data)))
+		w.WriteHeader(204)
+	default:
+		w.WriteHeader(405)
+	}
+}
+
+type tusMemoryStore struct {
+	mu   sync.Mutex
+	urls map[string]string
+}
+
+func (s *tusMemoryStore) Get(fingerprint string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	url, ok := s.urls[fingerprint]
+	return url, ok, nil
+}
+
+func (s *tusMemoryStore) Set(fingerprint string, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.urls[fingerprint] = url
+	return nil
+}
+
+func (s *tusMemoryStore) Delete(fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.urls, fingerprint)
+	return nil
+}
+
+func TestTusResumeFromStore(t *testing.T) {
+	ts, server := newTusTestServer()
+	defer server.Close()
+	store := &tusMemoryStore{urls: make(map[string]string)}
+	payload := bytes.Repeat([]byte("0123456789"), 10)
+
+	client := NewTusClient(server.URL+"/files/", nil)
+	client.ChunkSize = 30
+	client.MaxRetries = 1
+	client.Checksum = true
+	client.SetStore(store)
+	newUpload := func() *TusUpload {
+		return &TusUpload{Reader: bytes.NewReader(payload), Size: int64(len(payload)), Fingerprint: "fp"}
+	}
+
+	// the second chunk fails, and fails again on its single retry
+	ts.failFrom = 2
+	_, err := client.Upload(newUpload(), nil)
+	if err == nil {
+		t.Fatal("expected the first upload to fail")
+	}
+	stored, ok, _ := store.Get("fp")
+	if !ok || stored != server.URL+"/files/1" {
+		t.Fatalf("upload url not kept in the store: %q", stored)
+	}
+	ts.mu.Lock()
+	ts.failFrom = 0
+	ts.mu.Unlock()
+
+	var progress []int64
+	uploadURL, err := client.Upload(newUpload(), func(uploaded int64, total int64) {
+		progress = append(progress, uploaded)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploadURL != stored {
+		t.Errorf("resumed into %s, want %s", uploadURL, stored)
+	}
+	if ts.posts != 1 {
+		t.Errorf("%d uploads created, want 1", ts.posts)
+	}
+	if progress[0] != 30 {
+		t.Errorf("resumed at %d, want 30", progress[0])
+	}
+	if !bytes.Equal(ts.uploads["/files/1"], payload) {
+		t.Errorf("server got %q", ts.uploads["/files/1"])
+	}
+	if _, ok, _ := store.Get("fp"); ok {
+		t.Error("finished upload still in the store")
+	}
+}
+
+func TestTusShortReader(t *testing.T) {
+	_, server := newTusTestServer()
+	defer server.Close()
+
+	client := NewTusClient(server.URL+"/files/", nil)
+	upload := &TusUpload{Reader: strings.NewReader("only 12 byte"), Size: 100}
+	_, err := client.Upload(upload, nil)
+	if err == nil || !strings.Contains(err.Error(), "reader ended at 12 of 100") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestTusStalledOffset(t *testing.T) {
+	ts, server := newTusTestServer()
+	defer server.Close()
+	ts.stall = true
+
+	client := NewTusClient(server.URL+"/files/", nil)
+	upload := &TusUpload{Reader: strings.NewReader("some data"), Size: 9}
+	_, err := client.Upload(upload, nil)
+	if err == nil || !strings.Contains(err.Error(), "offset stuck at 0") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestTusCancelDuringRetry(t *testing.T) {
+	ts, server := newTusTestServer()
+	defer server.Close()
+	ts.failFrom = 1
+
+	client := NewTusClient(server.URL+"/files/", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	upload := &TusUpload{Reader: strings.NewReader("some data"), Size: 9}
+	_, err := client.UploadContext(ctx, upload, nil)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("retry wait ignored the context, took %v", elapsed)
+	}
+}
@@ -0,0 +1,183 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ------------------------------- hash slots -------------------------------
+
+// on a cluster, commands touching several keys only work when all the keys live in the same hash
+// slot. only the part of a key inside the first {...} is hashed, so "{user:42}:profile" and
+// "{user:42}:sessions" always share a slot. the multi-key calls below split their keys by slot
+// on their own, keys that have to change together (one transaction or script) need a common tag
+
+// the cluster slot (0-16383) a key hashes to
+func KeySlot(key string) int {
+	return int(crc16([]byte(hashTag(key))) % 16384)
+}
+
+// whether all the keys hash to the same slot, ie can be used in one multi-key command
+func SameSlot(keys ...string) bool {
+	for _, key := range keys {
+		if KeySlot(key) != KeySlot(keys[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// "{tag}" + key, for keys that must share a slot
+func WithHashTag(tag string, key string) string {
+	return "{" + tag + "}" + key
+}
+
+// the hashed part of a key: the content of the first non empty {...}, or the whole key
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+// keys grouped by slot, on a cluster. one group with everything otherwise
+func (r *RedisClient) bySlot(keys []string) [][]string {
+	if _, ok := r.client.(*redis.ClusterClient); !ok {
+		return [][]string{keys}
+	}
+	index := map[int]int{}
+	groups := [][]string{}
+	for _, key := range keys {
+		slot := KeySlot(key)
+		i, found := index[slot]
+		if !found {
+			i = len(groups)
+			index[slot] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], key)
+	}
+	return groups
+}
+
+// crc16 xmodem, as used by redis cluster
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// multi key operations-------------------------------------------------------------
+
+// values of several keys, missing keys are left out of the map
+func (r *RedisClient) GetMany(keys ...string) (map[string]string, error) {
+	return r.GetManyContext(context.Background(), keys...)
+}
+
+func (r *RedisClient) GetManyContext(ctx context.Context, keys ...string) (map[string]string, error) {
+	values := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+
+	groups := r.bySlot(keys)
+	cmds := make([]*redis.SliceCmd, len(groups))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, group := range groups {
+			cmds[i] = pipe.MGet(ctx, group...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, group := range groups {
+		for j, value := range cmds[i].Val() {
+			if s, ok := value.(string); ok {
+				values[group[j]] = s
+			}
+		}
+	}
+	return values, nil
+}
+
+// set several keys. keys in the same slot (eg sharing a hash tag) are written in one transaction
+func (r *RedisClient) SetMany(values map[string]string, minutes ...uint16) error {
+	// like Set(), a single ttl at most
+	if len(minutes) > 1 {
+		return fmt.Errorf("redis: SetMany takes one ttl, got %d", len(minutes))
+	}
+	ttl := time.Duration(0)
+	if len(minutes) == 1 {
+		ttl = time.Duration(minutes[0]) * time.Minute
+	}
+	return r.SetManyContext(context.Background(), values, ttl)
+}
+
+// ttl 0 keeps the keys forever
+func (r *RedisClient) SetManyContext(ctx context.Context, values map[string]string, ttl time.Duration) error {
+	// go-redis reads -1 as KEEPTTL, a negative ttl would silently keep the old expiry
+	if ttl < 0 {
+		return fmt.Errorf("redis: negative ttl %v for %d keys", ttl, len(values))
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	for _, group := range r.bySlot(keys) {
+		_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range group {
+				pipe.Set(ctx, key, values[key], preciseTTL(ttl))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delete several keys, returns how many existed
+func (r *RedisClient) UnsetMany(keys ...string) (int64, error) {
+	return r.UnsetManyContext(context.Background(), keys...)
+}
+
+func (r *RedisClient) UnsetManyContext(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	groups := r.bySlot(keys)
+	cmds := make([]*redis.IntCmd, len(groups))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, group := range groups {
+			cmds[i] = pipe.Del(ctx, group...)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, cmd := range cmds {
+		deleted += cmd.Val()
+	}
+	return deleted, nil
+}
@@ -0,0 +1,237 @@
+package redis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ------------------------------- typed values -------------------------------
+
+// turns values into bytes and back
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v any) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v any) error { return msgpack.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+var (
+	JSONCodec    Codec = jsonCodec{}
+	MsgpackCodec Codec = msgpackCodec{}
+	GobCodec     Codec = gobCodec{}
+)
+
+// every stored value starts with a small header: a magic byte, the envelope version, the id of
+// the codec that wrote it and flags (compression). values are always decoded with the codec and
+// compression they were written with, so the codec can be switched on a live system and old
+// values keep working. values without the header are taken as plain json, ie what callers used
+// to marshal by hand (or as is, when reading into a string)
+const (
+	envelopeMagic   = 0xfe
+	envelopeVersion = 1
+	envelopeSize    = 4
+
+	flagGzip = 1 << 0
+)
+
+// keyed by the dynamic type of the codec, so codecs of any type (maps, funcs, slices ...) work
+var codecs = struct {
+	sync.RWMutex
+	byID   map[byte]Codec
+	byType map[reflect.Type]byte
+}{
+	byID: map[byte]Codec{1: JSONCodec, 2: MsgpackCodec, 3: GobCodec},
+	byType: map[reflect.Type]byte{
+		reflect.TypeOf(JSONCodec):    1,
+		reflect.TypeOf(MsgpackCodec): 2,
+		reflect.TypeOf(GobCodec):     3,
+	},
+}
+
+// make a custom codec known under an id, 16-255 as the lower ones are reserved. the id is stored
+// with every value, so it must never be reused for another codec. codecs are told apart by their
+// type, register one codec per type
+func RegisterCodec(id byte, codec Codec) error {
+	if id < 16 {
+		return fmt.Errorf("redis: codec ids below 16 are reserved, got %d", id)
+	}
+	if codec == nil {
+		return fmt.Errorf("redis: nil codec for id %d", id)
+	}
+	codecType := reflect.TypeOf(codec)
+	codecs.Lock()
+	defer codecs.Unlock()
+	if existing, found := codecs.byID[id]; found && reflect.TypeOf(existing) != codecType {
+		return fmt.Errorf("redis: codec id %d is taken", id)
+	}
+	if existing, found := codecs.byType[codecType]; found && existing != id {
+		return fmt.Errorf("redis: codec %T is already registered as %d", codec, existing)
+	}
+	codecs.byID[id] = codec
+	codecs.byType[codecType] = id
+	return nil
+}
+
+// how typed values are written
+type ValueCodec struct {
+	Codec         Codec // default JSONCodec
+	CompressAbove int   // gzip encoded values larger than this many bytes, 0 never compresses
+}
+
+// codec for SetValue/PushValue and friends, reading works whatever codec wrote a value
+func (r *RedisClient) SetCodec(codec ValueCodec) {
+	r.codec = codec
+}
+
+func (c ValueCodec) encode(v any) ([]byte, error) {
+	codec := c.Codec
+	if codec == nil {
+		codec = JSONCodec
+	}
+	codecs.RLock()
+	id, found := codecs.byType[reflect.TypeOf(codec)]
+	codecs.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("redis: codec %T is not registered, see RegisterCodec", codec)
+	}
+
+	payload, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	flags := byte(0)
+	if c.CompressAbove > 0 && len(payload) > c.CompressAbove {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		writer.Write(payload)
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		payload = buf.Bytes()
+		flags |= flagGzip
+	}
+
+	data := make([]byte, envelopeSize, envelopeSize+len(payload))
+	data[0], data[1], data[2], data[3] = envelopeMagic, envelopeVersion, id, flags
+	return append(data, payload...), nil
+}
+
+func decodeValue(data []byte, v any) error {
+	if len(data) < envelopeSize || data[0] != envelopeMagic {
+		err := json.Unmarshal(data, v)
+		// a plain string written by Set() or Push()
+		if s, ok := v.(*string); ok && err != nil {
+			*s = string(data)
+			return nil
+		}
+		return err
+	}
+	if data[1] != envelopeVersion {
+		return fmt.Errorf("redis: value written with envelope version %d, this build reads %d", data[1], envelopeVersion)
+	}
+	codecs.RLock()
+	codec, found := codecs.byID[data[2]]
+	codecs.RUnlock()
+	if !found {
+		return fmt.Errorf("redis: value written with unknown codec %d", data[2])
+	}
+
+	payload := data[envelopeSize:]
+	if data[3]&flagGzip != 0 {
+		reader, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		if payload, err = io.ReadAll(reader); err != nil {
+			return err
+		}
+	}
+	return codec.Unmarshal(payload, v)
+}
+
+// store a value of any type, ttl 0 keeps it forever
+func SetValue[T any](ctx context.Context, r *RedisClient, key string, value T, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("redis: negative ttl %v for %q", ttl, key)
+	}
+	data, err := r.codec.encode(value)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, key, data, preciseTTL(ttl)).Err()
+}
+
+// read a value stored with SetValue (or plain json), ErrNotFound when the key does not exist
+func GetValue[T any](ctx context.Context, r *RedisClient, key string) (T, error) {
+	var value T
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return value, ErrNotFound
+		}
+		return value, err
+	}
+	err = decodeValue(data, &value)
+	return value, err
+}
+
+// push values onto a queue, like Push(). no values is a no-op
+func PushValue[T any](ctx context.Context, r *RedisClient, queue string, values ...T) error {
+	if len(values) == 0 {
+		return nil
+	}
+	items := make([]interface{}, len(values))
+	for i, value := range values {
+		data, err := r.codec.encode(value)
+		if err != nil {
+			return err
+		}
+		items[i] = data
+	}
+	return r.client.LPush(ctx, queue, items...).Err()
+}
+
+// oldest value of a queue, like Pop(). ErrNotFound when it is empty
+func PopValue[T any](ctx context.Context, r *RedisClient, queue string) (T, error) {
+	var value T
+	data, err := r.client.RPop(ctx, queue).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return value, ErrNotFound
+		}
+		return value, err
+	}
+	err = decodeValue(data, &value)
+	return value, err
+}
@@ -0,0 +1,144 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// expiry operations-------------------------------------------------------------
+
+// ttls are time.Durations with millisecond precision (PX/PEXPIRE under the hood), anything finer is
+// rounded up to the next millisecond so a key never expires earlier than asked for
+
+// when SetWithOptions writes
+type SetMode int
+
+const (
+	SetAlways   SetMode = iota
+	SetIfAbsent         // NX, only create
+	SetIfExists         // XX, only overwrite
+)
+
+type SetOptions struct {
+	Mode    SetMode
+	TTL     time.Duration // 0 keeps the key forever (unless KeepTTL)
+	KeepTTL bool          // overwrite the value but keep the current expiry (redis 6+)
+}
+
+// set a key with NX/XX semantics. false (and no error) when the mode stopped the write
+func (r *RedisClient) SetWithOptions(ctx context.Context, key string, value string, opts SetOptions) (bool, error) {
+	if opts.TTL < 0 {
+		return false, fmt.Errorf("redis: negative ttl %v for %q", opts.TTL, key)
+	}
+	if opts.KeepTTL && opts.TTL > 0 {
+		return false, fmt.Errorf("redis: KeepTTL and a TTL for %q", key)
+	}
+	args := redis.SetArgs{TTL: preciseTTL(opts.TTL), KeepTTL: opts.KeepTTL}
+	switch opts.Mode {
+	case SetIfAbsent:
+		args.Mode = "NX"
+	case SetIfExists:
+		args.Mode = "XX"
+	}
+	err := r.client.SetArgs(ctx, key, value, args).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// create the key only if it does not exist yet, false when it did
+func (r *RedisClient) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	return r.SetWithOptions(ctx, key, value, SetOptions{Mode: SetIfAbsent, TTL: ttl})
+}
+
+// overwrite the key only if it exists, false when it did not
+func (r *RedisClient) SetXX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	return r.SetWithOptions(ctx, key, value, SetOptions{Mode: SetIfExists, TTL: ttl})
+}
+
+// let the key expire after ttl, false when the key does not exist
+func (r *RedisClient) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		return false, fmt.Errorf("redis: ttl must be positive, got %v for %q", ttl, key)
+	}
+	return r.client.PExpire(ctx, key, preciseTTL(ttl)).Result()
+}
+
+// let the key expire at a point in time, false when the key does not exist
+func (r *RedisClient) ExpireAt(ctx context.Context, key string, at time.Time) (bool, error) {
+	return r.client.PExpireAt(ctx, key, at).Result()
+}
+
+// remove the expiry of a key, false when the key does not exist or had none
+func (r *RedisClient) Persist(ctx context.Context, key string) (bool, error) {
+	return r.client.Persist(ctx, key).Result()
+}
+
+// remaining time to live, -1 when the key does not expire, ErrNotFound when it does not exist
+func (r *RedisClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// go-redis hands the special replies back as plain -1/-2 nanoseconds
+	switch ttl {
+	case -2:
+		return 0, ErrNotFound
+	case -1:
+		return -1, nil
+	}
+	return ttl, nil
+}
+
+// replace a whole list and its expiry in one transaction, readers see the old or the new list,
+// and the list never exists without its ttl. ttl 0 keeps it forever
+func (r *RedisClient) SetList(ctx context.Context, key string, values []string, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("redis: negative ttl %v for %q", ttl, key)
+	}
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(values) > 0 {
+			items := make([]interface{}, len(values))
+			for i, value := range values {
+				items[i] = value
+			}
+			pipe.RPush(ctx, key, items...)
+			if ttl > 0 {
+				pipe.PExpire(ctx, key, preciseTTL(ttl))
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// set fields of a hash and (re)start its expiry in one transaction. ttl 0 leaves the expiry alone
+func (r *RedisClient) SetHashWithTTL(ctx context.Context, key string, fields map[string]string, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("redis: negative ttl %v for %q", ttl, key)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, fields)
+		if ttl > 0 {
+			pipe.PExpire(ctx, key, preciseTTL(ttl))
+		}
+		return nil
+	})
+	return err
+}
+
+// round up to whole milliseconds, redis has no finer resolution
+func preciseTTL(ttl time.Duration) time.Duration {
+	if rest := ttl % time.Millisecond; rest > 0 {
+		ttl += time.Millisecond - rest
+	}
+	return ttl
+}
@@ -0,0 +1,357 @@
+package redis
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hash operations-------------------------------------------------------------
+
+// set fields of a hash
+func (r *RedisClient) HSet(ctx context.Context, key string, fields map[string]string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return r.client.HSet(ctx, key, fields).Err()
+}
+
+// a field of a hash, ErrNotFound when the field (or the hash) does not exist
+func (r *RedisClient) HGet(ctx context.Context, key string, field string) (string, error) {
+	return notFound(r.client.HGet(ctx, key, field).Result())
+}
+
+// several fields of a hash, missing fields are left out of the map
+func (r *RedisClient) HMGet(ctx context.Context, key string, fields ...string) (map[string]string, error) {
+	values := make(map[string]string, len(fields))
+	if len(fields) == 0 {
+		return values, nil
+	}
+	result, err := r.client.HMGet(ctx, key, fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range result {
+		if s, ok := value.(string); ok {
+			values[fields[i]] = s
+		}
+	}
+	return values, nil
+}
+
+// the whole hash, empty when it does not exist
+func (r *RedisClient) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return r.client.HGetAll(ctx, key).Result()
+}
+
+// delete fields of a hash, returns how many existed
+func (r *RedisClient) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	return r.client.HDel(ctx, key, fields...).Result()
+}
+
+// add to a counter field (created at 0), returns the new value
+func (r *RedisClient) HIncrBy(ctx context.Context, key string, field string, by int64) (int64, error) {
+	return r.client.HIncrBy(ctx, key, field, by).Result()
+}
+
+func (r *RedisClient) HIncrByFloat(ctx context.Context, key string, field string, by float64) (float64, error) {
+	return r.client.HIncrByFloat(ctx, key, field, by).Result()
+}
+
+// ------------------------------- struct mapping -------------------------------
+
+// structs map to hashes field by field, named by the `redis` tag (the field name without one):
+//
+//	type Session struct {
+//		UserID   int64         `redis:"user_id"`
+//		Admin    bool          `redis:"admin"`
+//		Expires  time.Time     `redis:"expires"` // RFC 3339
+//		Idle     time.Duration `redis:"idle"`    // "1m30s"
+//		Note     string        `redis:"note,omitempty"`
+//		Roles    []string      `redis:"roles"` // json
+//		Cache    []byte        `redis:"-"`     // skipped
+//		internal string        // unexported, skipped
+//	}
+//
+// strings, numbers, bools, times and durations are stored as plain text so they stay readable and
+// HIncrBy works on numbers. types implementing encoding.TextMarshaler use it, anything else is json.
+// nil pointers and omitempty zero values are not written
+
+// write a struct (or a pointer to one) into a hash. with field names (tag names) only those fields
+// are written, the rest of the hash is left alone
+func (r *RedisClient) HSetStruct(ctx context.Context, key string, v any, fields ...string) error {
+	values, err := structToHash(v, fields)
+	if err != nil {
+		return err
+	}
+	return r.HSet(ctx, key, values)
+}
+
+// read a hash into a struct pointer. with field names only those fields are read. fields missing
+// in the hash keep their value. ErrNotFound when the hash does not exist
+func (r *RedisClient) HGetStruct(ctx context.Context, key string, v any, fields ...string) error {
+	var values map[string]string
+	var err error
+	if len(fields) > 0 {
+		values, err = r.HMGet(ctx, key, fields...)
+	} else {
+		values, err = r.HGetAll(ctx, key)
+	}
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		if len(fields) == 0 {
+			return ErrNotFound
+		}
+		// could be a hash without these fields, ask
+		if exists, err := r.client.Exists(ctx, key).Result(); err != nil {
+			return err
+		} else if exists == 0 {
+			return ErrNotFound
+		}
+	}
+	return hashToStruct(values, v)
+}
+
+type hashField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var hashFieldCache sync.Map // reflect.Type -> []hashField
+
+func hashFields(t reflect.Type) []hashField {
+	if cached, ok := hashFieldCache.Load(t); ok {
+		return cached.([]hashField)
+	}
+	fields := []hashField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("redis")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, hashField{name: name, index: f.Index, omitEmpty: options == "omitempty"})
+	}
+	hashFieldCache.Store(t, fields)
+	return fields
+}
+
+func structValue(v any) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return rv, fmt.Errorf("redis: nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return rv, fmt.Errorf("redis: expected a struct, got %T", v)
+	}
+	return rv, nil
+}
+
+func structToHash(v any, only []string) (map[string]string, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for _, field := range hashFields(rv.Type()) {
+		if len(only) > 0 && !contains(only, field.name) {
+			continue
+		}
+		fv := rv.FieldByIndex(field.index)
+		if field.omitEmpty && fv.IsZero() {
+			continue
+		}
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		text, err := formatField(fv)
+		if err != nil {
+			return nil, fmt.Errorf("redis: field %s: %w", field.name, err)
+		}
+		values[field.name] = text
+	}
+	for _, name := range only {
+		if _, found := values[name]; !found && !hasField(rv.Type(), name) {
+			return nil, fmt.Errorf("redis: %s has no field %q", rv.Type(), name)
+		}
+	}
+	return values, nil
+}
+
+func hashToStruct(values map[string]string, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("redis: expected a struct pointer, got %T", v)
+	}
+	rv, err := structValue(v)
+	if err != nil {
+		return err
+	}
+	for _, field := range hashFields(rv.Type()) {
+		text, found := values[field.name]
+		if !found {
+			continue
+		}
+		fv := rv.FieldByIndex(field.index)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			fv = fv.Elem()
+		}
+		if err := parseField(text, fv); err != nil {
+			return fmt.Errorf("redis: field %s: %w", field.name, err)
+		}
+	}
+	return nil
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+func formatField(fv reflect.Value) (string, error) {
+	switch fv.Type() {
+	case timeType:
+		return fv.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	case durationType:
+		return time.Duration(fv.Int()).String(), nil
+	}
+	if marshaler, ok := fv.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'g', -1, fv.Type().Bits()), nil
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(fv.Bytes()), nil
+		}
+	}
+	data, err := json.Marshal(fv.Interface())
+	return string(data), err
+}
+
+func parseField(text string, fv reflect.Value) error {
+	switch fv.Type() {
+	case timeType:
+		t, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			// unix seconds, as written by other clients
+			seconds, intErr := strconv.ParseInt(text, 10, 64)
+			if intErr != nil {
+				return err
+			}
+			t = time.Unix(seconds, 0)
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			// plain nanoseconds
+			n, intErr := strconv.ParseInt(text, 10, 64)
+			if intErr != nil {
+				return err
+			}
+			d = time.Duration(n)
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	if unmarshaler, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(text))
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(text)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			fv.SetBytes([]byte(text))
+			return nil
+		}
+	}
+	return json.Unmarshal([]byte(text), fv.Addr().Interface())
+}
+
+func hasField(t reflect.Type, name string) bool {
+	for _, field := range hashFields(t) {
+		if field.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
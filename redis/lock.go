@@ -0,0 +1,325 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ------------------------------- distributed lock -------------------------------
+
+var (
+	ErrLockNotAcquired = errors.New("redis: lock is held by someone else")
+	ErrLockNotHeld     = errors.New("redis: lock is not held (expired or taken over)")
+)
+
+// delete / extend the key only while it still holds our token, so a lock that expired and was
+// taken by someone else is never touched
+var (
+	unlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+	extendScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+type LockOptions struct {
+	TTL            time.Duration // lease, default 30s. a crashed holder blocks others for at most this long
+	DisableRenewal bool          // by default the lease is extended every TTL/3 until Unlock(). without, Lost() closes when it runs out
+	RetryDelay     time.Duration // first wait between attempts in Lock(), default 50ms, doubled each time
+	MaxRetryDelay  time.Duration // cap of the wait, default 1s
+}
+
+// a held lock
+type Lock struct {
+	Key string
+
+	token    string
+	ttl      time.Duration
+	locker   *Redlock
+	lost     chan struct{}
+	lostOnce sync.Once
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	mu         sync.Mutex
+	lease      time.Duration // what renewals extend to, ttl until Extend() picks another one
+	validUntil time.Time     // end of the lease as far as we know, minus drift
+	changed    chan struct{} // wakes the watcher after Extend()
+}
+
+// a lock over several independent redis instances (not replicas of each other), held when a
+// majority of them agree. survives the loss of a minority of the instances
+type Redlock struct {
+	clients []*RedisClient
+}
+
+func NewRedlock(clients ...*RedisClient) *Redlock {
+	return &Redlock{clients: clients}
+}
+
+// take the lock once, ErrLockNotAcquired when it is held elsewhere
+func (r *RedisClient) TryLock(ctx context.Context, key string, opts LockOptions) (*Lock, error) {
+	return NewRedlock(r).TryLock(ctx, key, opts)
+}
+
+// wait for the lock until it is acquired or ctx is done
+func (r *RedisClient) Lock(ctx context.Context, key string, opts LockOptions) (*Lock, error) {
+	return NewRedlock(r).Lock(ctx, key, opts)
+}
+
+// take the lock once on a majority of the instances, ErrLockNotAcquired when that fails
+func (rl *Redlock) TryLock(ctx context.Context, key string, opts LockOptions) (*Lock, error) {
+	if len(rl.clients) == 0 {
+		return nil, fmt.Errorf("redis: redlock without instances")
+	}
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	acquired, firstErr := rl.each(ctx, func(client *RedisClient) (bool, error) {
+		return client.client.SetNX(ctx, key, token, preciseTTL(ttl)).Result()
+	})
+
+	// the lease only counts for what is left of the ttl, minus some clock drift between instances
+	drift := ttl/100 + 2*time.Millisecond
+	if acquired < rl.quorum() || time.Since(start)+drift >= ttl {
+		rl.release(context.Background(), key, token)
+		if acquired == 0 && firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, ErrLockNotAcquired
+	}
+
+	lock := &Lock{
+		Key:    key,
+		token:  token,
+		ttl:    ttl,
+		locker: rl,
+		lost:   make(chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+
+		lease:      ttl,
+		validUntil: start.Add(ttl - drift),
+		changed:    make(chan struct{}, 1),
+	}
+	go lock.watch(!opts.DisableRenewal)
+	return lock, nil
+}
+
+// wait for the lock until it is acquired or ctx is done, retrying with jittered exponential backoff
+func (rl *Redlock) Lock(ctx context.Context, key string, opts LockOptions) (*Lock, error) {
+	delay := opts.RetryDelay
+	if delay <= 0 {
+		delay = 50 * time.Millisecond
+	}
+	maxDelay := opts.MaxRetryDelay
+	if maxDelay <= 0 {
+		maxDelay = time.Second
+	}
+	for {
+		lock, err := rl.TryLock(ctx, key, opts)
+		if err == nil {
+			return lock, nil
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("redis: waiting for lock %q: %w", key, ctx.Err())
+		}
+
+		// full jitter, so waiting replicas do not retry in lockstep
+		wait := time.Duration(mathrand.Int63n(int64(delay)) + 1)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("redis: waiting for lock %q: %w", key, ctx.Err())
+		}
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// the random value identifying this holder
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// closed when the lease is lost: it expired before it could be renewed (or, with DisableRenewal,
+// before Extend() was called), or someone else holds the key now. whatever the lock protects
+// should stop right away
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// extend the lease to ttl from now, ErrLockNotHeld when it is gone. later renewals keep
+// extending it by ttl
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("redis: ttl must be positive, got %v", ttl)
+	}
+	start := time.Now()
+	extended, _ := l.locker.each(ctx, func(client *RedisClient) (bool, error) {
+		n, err := extendScript.Run(ctx, client.client, []string{l.Key}, l.token, preciseTTL(ttl).Milliseconds()).Int64()
+		return n == 1, err
+	})
+	if extended < l.locker.quorum() {
+		return ErrLockNotHeld
+	}
+	l.extended(start, ttl)
+	// the lease may be shorter now, the watcher has to rearm its timers
+	select {
+	case l.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// stop renewing and release the lock. ErrLockNotHeld when it had already been lost
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.done
+	if released, _ := l.locker.release(ctx, l.Key, l.token); released == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// the lease was set to ttl at start (before the first instance was asked). that is what the key
+// expires with now, shorter or longer than before
+func (l *Lock) extended(start time.Time, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lease = ttl
+	l.validUntil = start.Add(ttl - ttl/100 - 2*time.Millisecond)
+}
+
+func (l *Lock) leaseTTL() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lease
+}
+
+func (l *Lock) deadline() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.validUntil
+}
+
+// closes Lost() once the lease runs out without a renewal, until Unlock(). with renew set, the
+// lease is extended every ttl/3 as well: failed renewals (redis unreachable) are retried until the
+// lease runs out, a renewal that finds another token ends it right away
+func (l *Lock) watch(renew bool) {
+	defer close(l.done)
+	expiry := time.NewTimer(time.Until(l.deadline()))
+	defer expiry.Stop()
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	var tick <-chan time.Time
+	if renew {
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-l.changed:
+			if !expiry.Stop() {
+				<-expiry.C
+			}
+			expiry.Reset(time.Until(l.deadline()))
+			ticker.Reset(l.leaseTTL() / 3)
+			continue
+		case <-expiry.C:
+			// a renewal may have moved the deadline meanwhile
+			if left := time.Until(l.deadline()); left > 0 {
+				expiry.Reset(left)
+				continue
+			}
+			l.lostOnce.Do(func() { close(l.lost) })
+			return
+		case <-tick:
+		}
+
+		lease := l.leaseTTL()
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+		start := time.Now()
+		extended, err := l.locker.each(ctx, func(client *RedisClient) (bool, error) {
+			n, err := extendScript.Run(ctx, client.client, []string{l.Key}, l.token, preciseTTL(lease).Milliseconds()).Int64()
+			return n == 1, err
+		})
+		cancel()
+
+		switch {
+		case extended >= l.locker.quorum():
+			l.extended(start, lease)
+		case err == nil || time.Now().After(l.deadline()):
+			l.lostOnce.Do(func() { close(l.lost) })
+			return
+		}
+	}
+}
+
+// run fn on every instance in parallel, returns how many returned true and the first error
+func (rl *Redlock) each(ctx context.Context, fn func(client *RedisClient) (bool, error)) (int, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	count := 0
+	var firstErr error
+	for _, client := range rl.clients {
+		wg.Add(1)
+		go func(client *RedisClient) {
+			defer wg.Done()
+			ok, err := fn(client)
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				count++
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(client)
+	}
+	wg.Wait()
+	return count, firstErr
+}
+
+func (rl *Redlock) release(ctx context.Context, key string, token string) (int, error) {
+	return rl.each(ctx, func(client *RedisClient) (bool, error) {
+		n, err := unlockScript.Run(ctx, client.client, []string{key}, token).Int64()
+		return n == 1, err
+	})
+}
+
+func (rl *Redlock) quorum() int {
+	return len(rl.clients)/2 + 1
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,345 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ------------------------------- reliable queue -------------------------------
+
+// Push()/Pop() lose a message when the worker dies right after popping it. a reliable queue moves
+// every message it hands out to a processing list of the consumer (atomically, so it is always in
+// one of the lists) and remembers a deadline for it. Ack() removes it for good, a message that is
+// not acked before its visibility timeout is put back in the queue by the reaper, and after
+// MaxAttempts deliveries it goes to the dead letter list instead.
+//
+// all keys share the queue name as hash tag, so a queue works on a cluster:
+//
+//	{name}:pending                 ids waiting for a consumer
+//	{name}:processing:<consumer>   ids a consumer is working on
+//	{name}:deadlines               id -> ms when the delivery times out
+//	{name}:messages                id -> body
+//	{name}:attempts                id -> deliveries so far
+//	{name}:dead                    ids that ran out of attempts
+//	{name}:consumers               names of consumers that have processing lists
+
+var ErrMessageNotHeld = errors.New("redis: message is not held by this consumer (visibility timeout passed)")
+
+type ReliableQueueOptions struct {
+	// name of this worker, default the hostname. workers sharing a name share a processing list, a
+	// stable name (eg the pod name) makes a restarted worker find its own list again
+	Consumer          string
+	VisibilityTimeout time.Duration // time to Ack() a message before it is delivered again, default 30s
+	MaxAttempts       int           // deliveries before a message is dead lettered, default 5
+	Logger            *log.Logger   // failed reaps of RunReaper(), default log.Default()
+}
+
+type QueueMessage struct {
+	ID       string
+	Body     string
+	Attempts int // deliveries including this one
+}
+
+type ReliableQueue struct {
+	client     *RedisClient
+	name       string
+	opts       ReliableQueueOptions
+	processing string
+}
+
+func NewReliableQueue(client *RedisClient, name string, opts ReliableQueueOptions) *ReliableQueue {
+	if opts.Consumer == "" {
+		opts.Consumer, _ = os.Hostname()
+	}
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 30 * time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.Default()
+	}
+	q := &ReliableQueue{client: client, name: name, opts: opts}
+	q.processing = q.processingKey(opts.Consumer)
+	return q
+}
+
+func (q *ReliableQueue) key(suffix string) string {
+	return WithHashTag(q.name, ":"+suffix)
+}
+
+func (q *ReliableQueue) processingKey(consumer string) string {
+	return q.key("processing:" + consumer)
+}
+
+// add messages to the end of the queue
+func (q *ReliableQueue) Push(ctx context.Context, bodies ...string) error {
+	if len(bodies) == 0 {
+		return nil
+	}
+	ids := make([]interface{}, len(bodies))
+	messages := make(map[string]interface{}, len(bodies))
+	for i, body := range bodies {
+		id, err := newToken()
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+		messages[id] = body
+	}
+	_, err := q.client.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, q.key("messages"), messages)
+		pipe.LPush(ctx, q.key("pending"), ids...)
+		return nil
+	})
+	return err
+}
+
+// next message, ErrNotFound when the queue is empty. Ack() it when done
+func (q *ReliableQueue) Pop(ctx context.Context) (QueueMessage, error) {
+	return q.claim(ctx, queuePopScript, "")
+}
+
+// next message, waiting up to timeout (0 waits forever) for one. ErrNotFound when none came. the
+// timeout is rounded up to whole seconds, redis has no finer resolution for BRPOPLPUSH
+func (q *ReliableQueue) PopBlocking(ctx context.Context, timeout time.Duration) (QueueMessage, error) {
+	if rest := timeout % time.Second; rest > 0 {
+		timeout += time.Second - rest
+	}
+	// registered first, so the reaper finds the message even if we die right after the move
+	if err := q.client.client.SAdd(ctx, q.key("consumers"), q.opts.Consumer).Err(); err != nil {
+		return QueueMessage{}, err
+	}
+	id, err := q.client.client.BRPopLPush(ctx, q.key("pending"), q.processing, timeout).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return QueueMessage{}, ErrNotFound
+		}
+		return QueueMessage{}, err
+	}
+	return q.claim(ctx, queueClaimScript, id)
+}
+
+func (q *ReliableQueue) claim(ctx context.Context, script *redis.Script, id string) (QueueMessage, error) {
+	keys := []string{q.key("pending"), q.processing, q.key("deadlines"), q.key("messages"), q.key("attempts"), q.key("consumers")}
+	values, err := script.Run(ctx, q.client.client, keys, q.opts.VisibilityTimeout.Milliseconds(), q.opts.Consumer, id).Slice()
+	if err != nil {
+		if err == redis.Nil {
+			return QueueMessage{}, ErrNotFound
+		}
+		return QueueMessage{}, err
+	}
+	message := QueueMessage{ID: values[0].(string), Attempts: int(values[2].(int64))}
+	message.Body, _ = values[1].(string)
+	return message, nil
+}
+
+// done with a message, it is removed for good. ErrMessageNotHeld when it timed out and was put
+// back in the queue (another consumer may be working on it now)
+func (q *ReliableQueue) Ack(ctx context.Context, message QueueMessage) error {
+	keys := []string{q.processing, q.key("deadlines"), q.key("messages"), q.key("attempts")}
+	acked, err := queueAckScript.Run(ctx, q.client.client, keys, message.ID).Int()
+	if err != nil {
+		return err
+	}
+	if acked == 0 {
+		return ErrMessageNotHeld
+	}
+	return nil
+}
+
+// give a message back right away for another delivery, or to the dead letter list when it is out
+// of attempts
+func (q *ReliableQueue) Nack(ctx context.Context, message QueueMessage) error {
+	keys := []string{q.processing, q.key("deadlines"), q.key("attempts"), q.key("pending"), q.key("dead")}
+	released, err := queueNackScript.Run(ctx, q.client.client, keys, message.ID, q.opts.MaxAttempts).Int()
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		return ErrMessageNotHeld
+	}
+	return nil
+}
+
+// put messages whose visibility timeout passed back in the queue (or dead letter them), in the
+// processing lists of all consumers. returns how many were requeued and dead lettered
+func (q *ReliableQueue) Reap(ctx context.Context) (requeued int, dead int, err error) {
+	consumers, err := q.client.client.SMembers(ctx, q.key("consumers")).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, consumer := range consumers {
+		keys := []string{q.processingKey(consumer), q.key("deadlines"), q.key("attempts"), q.key("pending"), q.key("dead")}
+		counts, err := queueReapScript.Run(ctx, q.client.client, keys, q.opts.VisibilityTimeout.Milliseconds(), q.opts.MaxAttempts).Int64Slice()
+		if err != nil {
+			return requeued, dead, err
+		}
+		requeued += int(counts[0])
+		dead += int(counts[1])
+	}
+	return requeued, dead, nil
+}
+
+// Reap() every interval until ctx is done, run it in a goroutine. one reaper per queue is enough,
+// more do no harm. failed runs (redis unreachable) are logged and retried on the next tick
+func (q *ReliableQueue) RunReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, _, err := q.Reap(ctx); err != nil && ctx.Err() == nil {
+				q.opts.Logger.Printf("redis: reaping queue %s: %v", q.name, err)
+			}
+		}
+	}
+}
+
+// messages waiting for a consumer
+func (q *ReliableQueue) Len(ctx context.Context) (int64, error) {
+	return q.client.client.LLen(ctx, q.key("pending")).Result()
+}
+
+// up to limit dead lettered messages, oldest first
+func (q *ReliableQueue) DeadLetters(ctx context.Context, limit int) ([]QueueMessage, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("redis: limit must be positive, got %d", limit)
+	}
+	ids, err := q.client.client.LRange(ctx, q.key("dead"), int64(-limit), -1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	var bodies, attempts *redis.SliceCmd
+	_, err = q.client.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		bodies = pipe.HMGet(ctx, q.key("messages"), ids...)
+		attempts = pipe.HMGet(ctx, q.key("attempts"), ids...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]QueueMessage, len(ids))
+	for i := range ids {
+		// oldest is at the end of the list
+		id := ids[len(ids)-1-i]
+		messages[i].ID = id
+		messages[i].Body, _ = bodies.Val()[len(ids)-1-i].(string)
+		if s, ok := attempts.Val()[len(ids)-1-i].(string); ok {
+			messages[i].Attempts, _ = strconv.Atoi(s)
+		}
+	}
+	return messages, nil
+}
+
+// move all dead lettered messages back into the queue with fresh attempts, eg after fixing the
+// bug that killed them. returns how many were moved
+func (q *ReliableQueue) RetryDeadLetters(ctx context.Context) (int, error) {
+	keys := []string{q.key("dead"), q.key("pending"), q.key("attempts")}
+	return queueRetryDeadScript.Run(ctx, q.client.client, keys).Int()
+}
+
+// delete all dead lettered messages, returns how many there were
+func (q *ReliableQueue) DropDeadLetters(ctx context.Context) (int, error) {
+	keys := []string{q.key("dead"), q.key("messages"), q.key("attempts")}
+	return queueDropDeadScript.Run(ctx, q.client.client, keys).Int()
+}
+
+// KEYS pending, processing, deadlines, messages, attempts, consumers
+// ARGV visibility timeout (ms), consumer, id (claim only)
+const queueClaim = serverNow + `
+local function claim(id)
+	redis.call("zadd", KEYS[3], now + tonumber(ARGV[1]), id)
+	local attempts = redis.call("hincrby", KEYS[5], id, 1)
+	redis.call("sadd", KEYS[6], ARGV[2])
+	return {id, redis.call("hget", KEYS[4], id), attempts}
+end
+`
+
+var queuePopScript = redis.NewScript(queueClaim + `
+local id = redis.call("rpoplpush", KEYS[1], KEYS[2])
+if not id then
+	return false
+end
+return claim(id)`)
+
+// after a blocking move to the processing list
+var queueClaimScript = redis.NewScript(queueClaim + `
+return claim(ARGV[3])`)
+
+// KEYS processing, deadlines, messages, attempts. ARGV id
+var queueAckScript = redis.NewScript(`
+if redis.call("lrem", KEYS[1], -1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call("zrem", KEYS[2], ARGV[1])
+redis.call("hdel", KEYS[3], ARGV[1])
+redis.call("hdel", KEYS[4], ARGV[1])
+return 1`)
+
+// back in front of the queue, or dead lettered when out of attempts
+// KEYS processing, deadlines, attempts, pending, dead. ARGV max attempts
+const queueRelease = `
+local function release(id)
+	redis.call("zrem", KEYS[2], id)
+	if tonumber(redis.call("hget", KEYS[3], id) or "0") >= tonumber(ARGV[2]) then
+		redis.call("lpush", KEYS[5], id)
+		return 2
+	end
+	redis.call("rpush", KEYS[4], id)
+	return 1
+end
+`
+
+// ARGV id, max attempts
+var queueNackScript = redis.NewScript(queueRelease + `
+if redis.call("lrem", KEYS[1], -1, ARGV[1]) == 0 then
+	return 0
+end
+return release(ARGV[1])`)
+
+// ARGV visibility timeout (ms), max attempts
+var queueReapScript = redis.NewScript(serverNow + queueRelease + `
+local requeued, dead = 0, 0
+for _, id in ipairs(redis.call("lrange", KEYS[1], 0, -1)) do
+	local deadline = redis.call("zscore", KEYS[2], id)
+	if not deadline then
+		-- moved by a blocking pop whose consumer died before claiming it, give it a full timeout
+		redis.call("zadd", KEYS[2], now + tonumber(ARGV[1]), id)
+	elseif tonumber(deadline) <= now then
+		redis.call("lrem", KEYS[1], -1, id)
+		if release(id) == 2 then dead = dead + 1 else requeued = requeued + 1 end
+	end
+end
+return {requeued, dead}`)
+
+// KEYS dead, pending, attempts
+var queueRetryDeadScript = redis.NewScript(`
+local ids = redis.call("lrange", KEYS[1], 0, -1)
+-- newest first, so the oldest ends up in front
+for _, id in ipairs(ids) do
+	redis.call("hdel", KEYS[3], id)
+	redis.call("rpush", KEYS[2], id)
+end
+redis.call("del", KEYS[1])
+return #ids`)
+
+// KEYS dead, messages, attempts
+var queueDropDeadScript = redis.NewScript(`
+local ids = redis.call("lrange", KEYS[1], 0, -1)
+for _, id in ipairs(ids) do
+	redis.call("hdel", KEYS[2], id)
+	redis.call("hdel", KEYS[3], id)
+end
+redis.call("del", KEYS[1])
+return #ids`)
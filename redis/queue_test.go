@@ -0,0 +1,128 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestQueue(r *testRedis, consumer string) *ReliableQueue {
+	return NewReliableQueue(r.client, "jobs", ReliableQueueOptions{Consumer: consumer, VisibilityTimeout: time.Second, MaxAttempts: 2})
+}
+
+func TestReliableQueueAck(t *testing.T) {
+	r := newTestRedis(t)
+	ctx := context.Background()
+	a, b := newTestQueue(r, "a"), newTestQueue(r, "b")
+
+	if _, err := a.Pop(ctx); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("empty queue: %v", err)
+	}
+	a.Push(ctx, "one", "two")
+	first, err := a.Pop(ctx)
+	if err != nil || first.Body != "one" || first.Attempts != 1 {
+		t.Fatalf("%+v %v", first, err)
+	}
+	second, err := b.PopBlocking(ctx, time.Second)
+	if err != nil || second.Body != "two" {
+		t.Fatalf("%+v %v", second, err)
+	}
+	if err := b.Ack(ctx, first); !errors.Is(err, ErrMessageNotHeld) {
+		t.Errorf("acked a message of another consumer: %v", err)
+	}
+	for _, ack := range []struct {
+		queue   *ReliableQueue
+		message QueueMessage
+	}{{a, first}, {b, second}} {
+		if err := ack.queue.Ack(ctx, ack.message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Ack(ctx, first); !errors.Is(err, ErrMessageNotHeld) {
+		t.Errorf("acked twice: %v", err)
+	}
+	if keys := r.Keys(); len(keys) != 1 || keys[0] != "{jobs}:consumers" {
+		t.Errorf("left behind %v", keys)
+	}
+}
+
+// a consumer dies holding a message: it comes back once the visibility timeout passed, in front of
+// the queue, and is dead lettered after MaxAttempts deliveries
+func TestReliableQueueRedeliveryAndDeadLetters(t *testing.T) {
+	r := newTestRedis(t)
+	ctx := context.Background()
+	a, b := newTestQueue(r, "a"), newTestQueue(r, "b")
+	a.Push(ctx, "one", "two")
+	lost, _ := a.Pop(ctx)
+
+	r.advance(999 * time.Millisecond)
+	if requeued, dead, err := b.Reap(ctx); requeued != 0 || dead != 0 || err != nil {
+		t.Fatalf("reaped before the timeout: %d %d %v", requeued, dead, err)
+	}
+	r.advance(time.Millisecond)
+	if requeued, dead, err := b.Reap(ctx); requeued != 1 || dead != 0 || err != nil {
+		t.Fatalf("reap: %d %d %v", requeued, dead, err)
+	}
+	if err := a.Ack(ctx, lost); !errors.Is(err, ErrMessageNotHeld) {
+		t.Errorf("late ack: %v", err)
+	}
+
+	again, err := b.Pop(ctx)
+	if err != nil || again.ID != lost.ID || again.Attempts != 2 {
+		t.Fatalf("redelivery: %+v %v", again, err)
+	}
+	if err := b.Nack(ctx, again); err != nil {
+		t.Fatal(err)
+	}
+	dead, err := b.DeadLetters(ctx, 10)
+	if err != nil || len(dead) != 1 || dead[0].Body != "one" || dead[0].Attempts != 2 {
+		t.Fatalf("dead letters: %+v %v", dead, err)
+	}
+	if n, _ := b.Len(ctx); n != 1 {
+		t.Errorf("%d pending, want 1", n)
+	}
+
+	// retried with fresh attempts, in front of what is pending
+	if n, err := b.RetryDeadLetters(ctx); n != 1 || err != nil {
+		t.Fatalf("retry: %d %v", n, err)
+	}
+	for _, want := range []string{"one", "two"} {
+		message, err := b.Pop(ctx)
+		if err != nil || message.Body != want || message.Attempts != 1 {
+			t.Fatalf("want %s: %+v %v", want, message, err)
+		}
+		b.Ack(ctx, message)
+	}
+
+	// dead lettered by the reaper, then dropped
+	a.Push(ctx, "three")
+	for i := 0; i < 2; i++ {
+		a.Pop(ctx)
+		r.advance(time.Second)
+		a.Reap(ctx)
+	}
+	if n, err := a.DropDeadLetters(ctx); n != 1 || err != nil {
+		t.Fatalf("drop: %d %v", n, err)
+	}
+	if dead, _ := a.DeadLetters(ctx, 10); len(dead) != 0 {
+		t.Errorf("still dead: %+v", dead)
+	}
+}
+
+func TestReliableQueueReaperLogs(t *testing.T) {
+	r := newTestRedis(t)
+	var logs bytes.Buffer
+	q := NewReliableQueue(r.client, "jobs", ReliableQueueOptions{Consumer: "a", Logger: log.New(&logs, "", 0)})
+	r.SetError("ERR out of order") // every reap fails from now on
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	q.RunReaper(ctx, 10*time.Millisecond)
+	if !strings.Contains(logs.String(), "redis: reaping queue jobs:") {
+		t.Errorf("nothing logged: %q", logs.String())
+	}
+}
@@ -0,0 +1,248 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ------------------------------- rate limiting -------------------------------
+
+// every check is one lua script, so concurrent callers on any number of instances never see a
+// half updated limit. the scripts take the time from the redis server (TIME), clocks of the app
+// instances do not matter
+
+type RateLimitAlgorithm int
+
+const (
+	// Limit requests per Period, counted in windows aligned to the clock. cheapest, but allows
+	// up to 2x Limit around the edge of two windows
+	FixedWindow RateLimitAlgorithm = iota
+	// every request is remembered (a sorted set) for Period. exact, memory grows with Limit
+	SlidingLog
+	// the current window count plus the previous one weighted by how much of it is still inside
+	// Period. close to SlidingLog with a fixed size
+	SlidingWindow
+	// Burst tokens refilled at Limit per Period, each request takes one
+	TokenBucket
+	// generic cell rate algorithm: requests evenly spaced at Period/Limit, up to Burst of them at
+	// once. same behavior as TokenBucket with a single timestamp stored
+	GCRA
+)
+
+type RateLimit struct {
+	Algorithm RateLimitAlgorithm
+	Limit     int           // requests per Period
+	Period    time.Duration // at least a millisecond
+	Burst     int           // TokenBucket / GCRA only, default Limit
+	Prefix    string        // of the redis keys, default "ratelimit:"
+}
+
+// outcome of a check, enough for the usual rate limit headers
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int           // requests that would still be allowed right now
+	RetryAfter time.Duration // when denied, wait this long before trying again. 0 when allowed
+	ResetAfter time.Duration // until the full limit is available again
+	ResetAt    time.Time
+}
+
+type RateLimiter struct {
+	client *RedisClient
+	limit  RateLimit
+	script *redis.Script
+}
+
+func NewRateLimiter(client *RedisClient, limit RateLimit) (*RateLimiter, error) {
+	if limit.Limit <= 0 {
+		return nil, fmt.Errorf("redis: rate limit must be positive, got %d", limit.Limit)
+	}
+	if limit.Period < time.Millisecond {
+		return nil, fmt.Errorf("redis: rate limit period must be at least 1ms, got %v", limit.Period)
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = limit.Limit
+	}
+	if limit.Prefix == "" {
+		limit.Prefix = "ratelimit:"
+	}
+	scripts := map[RateLimitAlgorithm]*redis.Script{
+		FixedWindow:   fixedWindowScript,
+		SlidingLog:    slidingLogScript,
+		SlidingWindow: slidingWindowScript,
+		TokenBucket:   tokenBucketScript,
+		GCRA:          gcraScript,
+	}
+	script, found := scripts[limit.Algorithm]
+	if !found {
+		return nil, fmt.Errorf("redis: unknown rate limit algorithm %d", limit.Algorithm)
+	}
+	return &RateLimiter{client: client, limit: limit, script: script}, nil
+}
+
+// take one request from the limit of key (an api key, user id, ip ...)
+func (l *RateLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// take n requests at once, all or nothing
+func (l *RateLimiter) AllowN(ctx context.Context, key string, n int) (RateLimitResult, error) {
+	capacity := l.limit.Limit
+	if l.limit.Algorithm == TokenBucket || l.limit.Algorithm == GCRA {
+		capacity = l.limit.Burst
+	}
+	if n <= 0 || n > capacity {
+		return RateLimitResult{}, fmt.Errorf("redis: can not take %d requests from a limit of %d", n, capacity)
+	}
+
+	args := []interface{}{l.limit.Limit, l.limit.Period.Milliseconds(), l.limit.Burst, n}
+	if l.limit.Algorithm == SlidingLog {
+		// members of the log have to be unique, lua has no usable randomness
+		token, err := newToken()
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		args = append(args, token)
+	}
+	values, err := l.script.Run(ctx, l.client.client, []string{l.limit.Prefix + key}, args...).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	result := RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      l.limit.Limit,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		ResetAfter: time.Duration(values[3]) * time.Millisecond,
+	}
+	result.ResetAt = time.Now().Add(result.ResetAfter)
+	return result, nil
+}
+
+// forget everything about key, eg after a successful login
+func (l *RateLimiter) Reset(ctx context.Context, key string) error {
+	return l.client.client.Del(ctx, l.limit.Prefix+key).Err()
+}
+
+// X-RateLimit-Limit / -Remaining / -Reset (seconds from now), and Retry-After (seconds) when denied
+func (res RateLimitResult) SetHeaders(header http.Header) {
+	header.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.ResetAfter), 10))
+	if !res.Allowed {
+		header.Set("Retry-After", strconv.FormatInt(ceilSeconds(res.RetryAfter), 10))
+	}
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// all scripts take KEYS[1] and ARGV limit, period (ms), burst, n and return
+// {allowed, remaining, retry after (ms), reset after (ms)}
+
+// `now` in milliseconds from the redis clock. redis < 5 only allows writes after TIME with effects
+// replication
+const serverNow = `
+if redis.replicate_commands then redis.replicate_commands() end
+local t = redis.call("time")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+`
+
+const rateLimitPrelude = serverNow + `
+local limit, period, burst, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+`
+
+var fixedWindowScript = redis.NewScript(rateLimitPrelude + `
+local reset = now - now % period + period
+local count = tonumber(redis.call("get", KEYS[1]) or "0")
+if count + n > limit then
+	return {0, math.max(limit - count, 0), reset - now, reset - now}
+end
+redis.call("incrby", KEYS[1], n)
+redis.call("pexpireat", KEYS[1], reset)
+return {1, limit - count - n, 0, reset - now}`)
+
+var slidingLogScript = redis.NewScript(rateLimitPrelude + `
+redis.call("zremrangebyscore", KEYS[1], "-inf", now - period)
+local count = redis.call("zcard", KEYS[1])
+if count + n > limit then
+	-- wait until enough of the oldest requests leave the window
+	local oldest = redis.call("zrange", KEYS[1], count + n - limit - 1, count + n - limit - 1, "withscores")
+	local newest = redis.call("zrange", KEYS[1], -1, -1, "withscores")
+	return {0, math.max(limit - count, 0), tonumber(oldest[2]) + period - now, tonumber(newest[2]) + period - now}
+end
+for i = 1, n do
+	redis.call("zadd", KEYS[1], now, ARGV[5] .. ":" .. i)
+end
+redis.call("pexpire", KEYS[1], period)
+return {1, limit - count - n, 0, period}`)
+
+var slidingWindowScript = redis.NewScript(rateLimitPrelude + `
+local start = now - now % period
+local state = redis.call("hmget", KEYS[1], "start", "current", "previous")
+local current, previous = tonumber(state[2] or "0"), tonumber(state[3] or "0")
+local stored = tonumber(state[1] or "0")
+if stored ~= start then
+	if stored == start - period then previous = current else previous = 0 end
+	current = 0
+end
+
+local elapsed = now - start
+local used = previous * (period - elapsed) / period + current
+local reset = start + period - now
+if current > 0 then reset = reset + period end
+
+if used + n > limit then
+	local retry
+	if current + n <= limit then
+		-- later in this window, once enough of the previous one has slid out
+		retry = start + period - (limit - current - n) * period / previous - now
+	else
+		-- in the next window, where this one is the previous
+		retry = start + 2 * period - (limit - n) * period / current - now
+	end
+	return {0, math.max(math.floor(limit - used), 0), math.ceil(retry), reset}
+end
+current = current + n
+redis.call("hset", KEYS[1], "start", start, "current", current, "previous", previous)
+redis.call("pexpire", KEYS[1], 2 * period)
+return {1, math.floor(limit - used - n), 0, start + 2 * period - now}`)
+
+var tokenBucketScript = redis.NewScript(rateLimitPrelude + `
+local rate = limit / period
+local state = redis.call("hmget", KEYS[1], "tokens", "at")
+local tokens = tonumber(state[1] or burst)
+local at = tonumber(state[2] or now)
+tokens = math.min(burst, tokens + math.max(now - at, 0) * rate)
+
+local allowed, retry = 0, 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = math.ceil((n - tokens) / rate)
+end
+local reset = math.ceil((burst - tokens) / rate)
+redis.call("hset", KEYS[1], "tokens", tokens, "at", now)
+redis.call("pexpire", KEYS[1], math.max(reset, 1))
+return {allowed, math.floor(tokens), retry, reset}`)
+
+// the key holds the theoretical arrival time: when the next request would be on schedule
+var gcraScript = redis.NewScript(rateLimitPrelude + `
+local interval = period / limit
+local tolerance = burst * interval
+local tat = math.max(tonumber(redis.call("get", KEYS[1]) or now), now)
+local next = tat + n * interval
+local allowAt = next - tolerance
+if now < allowAt then
+	return {0, math.max(math.floor((now - (tat - tolerance)) / interval), 0), math.ceil(allowAt - now), math.ceil(tat - now)}
+end
+redis.call("set", KEYS[1], next, "px", math.max(math.ceil(next - now), 1))
+return {1, math.floor((now - (next - tolerance)) / interval), 0, math.ceil(next - now)}`)
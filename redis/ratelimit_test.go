@@ -0,0 +1,121 @@
+package redis
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// five per second for every algorithm, the whole limit taken at once
+func TestRateLimitDenyAndRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		algorithm  RateLimitAlgorithm
+		retryAfter time.Duration
+	}{
+		{"fixed window", FixedWindow, 1000 * time.Millisecond},
+		{"sliding log", SlidingLog, 1000 * time.Millisecond},
+		{"sliding window", SlidingWindow, 1200 * time.Millisecond}, // the previous window still weighs 4/5 then
+		{"token bucket", TokenBucket, 200 * time.Millisecond},
+		{"gcra", GCRA, 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRedis(t)
+			ctx := context.Background()
+			limiter, err := NewRateLimiter(r.client, RateLimit{Algorithm: tt.algorithm, Limit: 5, Period: time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 5; i++ {
+				res, err := limiter.Allow(ctx, "user")
+				if err != nil || !res.Allowed || res.Remaining != 4-i {
+					t.Fatalf("request %d: %+v %v", i, res, err)
+				}
+			}
+			res, err := limiter.Allow(ctx, "user")
+			if err != nil || res.Allowed || res.Remaining != 0 {
+				t.Fatalf("6th request: %+v %v", res, err)
+			}
+			if res.RetryAfter != tt.retryAfter {
+				t.Errorf("retry after %v, want %v", res.RetryAfter, tt.retryAfter)
+			}
+			// other keys have limits of their own
+			if res, _ := limiter.Allow(ctx, "other"); !res.Allowed {
+				t.Error("other key denied")
+			}
+
+			r.advance(res.RetryAfter - time.Millisecond)
+			if res, _ := limiter.Allow(ctx, "user"); res.Allowed {
+				t.Errorf("allowed 1ms before retry after: %+v", res)
+			}
+			r.advance(time.Millisecond)
+			if res, _ := limiter.Allow(ctx, "user"); !res.Allowed {
+				t.Errorf("denied at retry after: %+v", res)
+			}
+		})
+	}
+}
+
+// the same traffic right before and after the edge of a window
+func TestRateLimitWindowEdge(t *testing.T) {
+	r := newTestRedis(t)
+	ctx := context.Background()
+	fixed, _ := NewRateLimiter(r.client, RateLimit{Algorithm: FixedWindow, Limit: 5, Period: time.Second, Prefix: "fixed:"})
+	sliding, _ := NewRateLimiter(r.client, RateLimit{Algorithm: SlidingWindow, Limit: 5, Period: time.Second, Prefix: "sliding:"})
+
+	r.advance(900 * time.Millisecond)
+	for _, limiter := range []*RateLimiter{fixed, sliding} {
+		if res, _ := limiter.AllowN(ctx, "k", 5); !res.Allowed {
+			t.Fatalf("%+v", res)
+		}
+	}
+	fixedRes, _ := fixed.Allow(ctx, "k")
+	if fixedRes.Allowed || fixedRes.RetryAfter != 100*time.Millisecond {
+		t.Errorf("fixed window before the edge: %+v", fixedRes)
+	}
+
+	r.advance(100 * time.Millisecond)
+	// a fresh window: the fixed window lets the full limit through again
+	if res, _ := fixed.AllowN(ctx, "k", 5); !res.Allowed {
+		t.Errorf("fixed window after the edge: %+v", res)
+	}
+	// the previous window still counts in full for the sliding one, 1 slot frees every 200ms
+	res, _ := sliding.Allow(ctx, "k")
+	if res.Allowed || res.RetryAfter != 200*time.Millisecond {
+		t.Errorf("sliding window after the edge: %+v", res)
+	}
+	r.advance(200 * time.Millisecond)
+	if res, _ := sliding.Allow(ctx, "k"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("sliding window 200ms after the edge: %+v", res)
+	}
+}
+
+func TestRateLimitBurstAndHeaders(t *testing.T) {
+	r := newTestRedis(t)
+	ctx := context.Background()
+	limiter, _ := NewRateLimiter(r.client, RateLimit{Algorithm: GCRA, Limit: 10, Period: time.Second, Burst: 2})
+	if _, err := limiter.AllowN(ctx, "k", 3); err == nil {
+		t.Error("took more than the burst")
+	}
+	limiter.AllowN(ctx, "k", 2)
+	res, _ := limiter.Allow(ctx, "k")
+	if res.Allowed || res.RetryAfter != 100*time.Millisecond {
+		t.Fatalf("%+v", res)
+	}
+
+	header := http.Header{}
+	res.SetHeaders(header)
+	if header.Get("X-RateLimit-Limit") != "10" || header.Get("X-RateLimit-Remaining") != "0" || header.Get("Retry-After") != "1" {
+		t.Errorf("headers %v", header)
+	}
+
+	if err := limiter.Reset(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := limiter.AllowN(ctx, "k", 2); !res.Allowed {
+		t.Errorf("after reset: %+v", res)
+	}
+}
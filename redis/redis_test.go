@@ -0,0 +1,35 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// a client on an in memory redis (lua included) whose clock the test moves by hand
+type testRedis struct {
+	*miniredis.Miniredis
+	client *RedisClient
+	now    time.Time
+}
+
+func newTestRedis(t *testing.T) *testRedis {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client, err := NewRedisWithOptions(RedisOptions{Addr: server.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	r := &testRedis{Miniredis: server, client: client, now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	server.SetTime(r.now)
+	return r
+}
+
+// move the server clock (TIME) and expire keys accordingly
+func (r *testRedis) advance(d time.Duration) {
+	r.now = r.now.Add(d)
+	r.SetTime(r.now)
+	r.FastForward(d)
+}
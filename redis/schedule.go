@@ -0,0 +1,310 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/robfig/cron/v3"
+)
+
+// ------------------------------- scheduled jobs -------------------------------
+
+// jobs for a later point in time live in a sorted set scored by when they are due. a poller takes
+// the due ones and either moves them to the reliable queue of the same name (see ReliableQueue) or
+// runs a handler on them. a taken job is leased, not removed: its score is pushed Lease into the
+// future, and it is only removed (or rescheduled, for cron jobs) once it was delivered. a poller
+// dying in between means the job comes due again after the lease, so every job runs at least
+// once. due times are compared against the redis clock (TIME), like the rate limiter. keys,
+// sharing the name as hash tag like the queue:
+//
+//	{name}:scheduled   id -> ms when due
+//	{name}:jobs        id -> body
+//	{name}:cron        id -> cron expression, recurring jobs only
+
+type SchedulerOptions struct {
+	Lease      time.Duration // how long a taken job is hidden from other pollers, default 1m. renewed right before its handler runs, keep it above the run time of one handler call
+	RetryDelay time.Duration // a job whose handler failed is due again after this, default 1m
+	Batch      int           // jobs taken per poll, default 100
+	Logger     *log.Logger   // failed polls of RunPoller(), default log.Default()
+}
+
+type ScheduledJob struct {
+	ID   string
+	Body string
+	Due  time.Time
+	Cron string // empty for one off jobs
+}
+
+// runs a due job. an error (or a panic) retries it after RetryDelay
+type JobHandler func(ctx context.Context, job ScheduledJob) error
+
+type Scheduler struct {
+	client *RedisClient
+	name   string
+	opts   SchedulerOptions
+}
+
+func NewScheduler(client *RedisClient, name string, opts SchedulerOptions) *Scheduler {
+	if opts.Lease <= 0 {
+		opts.Lease = time.Minute
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = time.Minute
+	}
+	if opts.Batch <= 0 {
+		opts.Batch = 100
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.Default()
+	}
+	return &Scheduler{client: client, name: name, opts: opts}
+}
+
+func (s *Scheduler) key(suffix string) string {
+	return WithHashTag(s.name, ":"+suffix)
+}
+
+// run body once at a point in time. an empty id gets a random one, an existing id is replaced.
+// returns the id, for Cancel()
+func (s *Scheduler) ScheduleAt(ctx context.Context, id string, body string, at time.Time) (string, error) {
+	return s.schedule(ctx, id, body, at, "")
+}
+
+// run body once after a delay
+func (s *Scheduler) ScheduleIn(ctx context.Context, id string, body string, delay time.Duration) (string, error) {
+	return s.schedule(ctx, id, body, time.Now().Add(delay), "")
+}
+
+// run body on a cron schedule until cancelled. standard 5 field expressions ("*/5 * * * *"),
+// descriptors ("@hourly", "@every 90s") and a "CRON_TZ=Europe/Berlin " prefix are understood,
+// times are local otherwise. occurrences missed while no poller ran are not caught up on, the
+// job runs once and continues with the next one
+func (s *Scheduler) ScheduleCron(ctx context.Context, id string, body string, spec string) (string, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return "", fmt.Errorf("redis: cron expression %q: %w", spec, err)
+	}
+	return s.schedule(ctx, id, body, schedule.Next(time.Now()), spec)
+}
+
+func (s *Scheduler) schedule(ctx context.Context, id string, body string, at time.Time, spec string) (string, error) {
+	if id == "" {
+		var err error
+		if id, err = newToken(); err != nil {
+			return "", err
+		}
+	}
+	_, err := s.client.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.key("jobs"), id, body)
+		if spec != "" {
+			pipe.HSet(ctx, s.key("cron"), id, spec)
+		} else {
+			pipe.HDel(ctx, s.key("cron"), id)
+		}
+		pipe.ZAdd(ctx, s.key("scheduled"), redis.Z{Score: float64(at.UnixMilli()), Member: id})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// remove a scheduled (or recurring) job, false when there was none. a job a poller has already
+// taken may still run once
+func (s *Scheduler) Cancel(ctx context.Context, id string) (bool, error) {
+	var removed *redis.IntCmd
+	_, err := s.client.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.ZRem(ctx, s.key("scheduled"), id)
+		pipe.HDel(ctx, s.key("jobs"), id)
+		pipe.HDel(ctx, s.key("cron"), id)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return removed.Val() == 1, nil
+}
+
+// a scheduled job, ErrNotFound when there is none
+func (s *Scheduler) Get(ctx context.Context, id string) (ScheduledJob, error) {
+	var due *redis.FloatCmd
+	var body, spec *redis.StringCmd
+	_, err := s.client.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		due = pipe.ZScore(ctx, s.key("scheduled"), id)
+		body = pipe.HGet(ctx, s.key("jobs"), id)
+		spec = pipe.HGet(ctx, s.key("cron"), id)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return ScheduledJob{}, err
+	}
+	if due.Err() == redis.Nil {
+		return ScheduledJob{}, ErrNotFound
+	}
+	return ScheduledJob{ID: id, Body: body.Val(), Due: time.UnixMilli(int64(due.Val())), Cron: spec.Val()}, nil
+}
+
+// jobs waiting to run, recurring ones included
+func (s *Scheduler) Len(ctx context.Context) (int64, error) {
+	return s.client.client.ZCard(ctx, s.key("scheduled")).Result()
+}
+
+// take the jobs that are due. without a handler they are pushed to the reliable queue of the same
+// name, message ids are "<job id>:<due ms>" so every run of a cron job is a message of its own.
+// a recurring job whose stored cron expression does not parse is moved to the dead letters of
+// that queue, the rest of the batch goes on and the error is returned at the end. returns how
+// many jobs were delivered (or handled without error)
+func (s *Scheduler) Poll(ctx context.Context, handler JobHandler) (int, error) {
+	keys := []string{s.key("scheduled"), s.key("jobs"), s.key("cron")}
+	result, err := scheduleTakeScript.Run(ctx, s.client.client, keys, s.opts.Lease.Milliseconds(), s.opts.Batch).Slice()
+	if err != nil {
+		return 0, err
+	}
+	// the redis clock, not ours
+	now := time.UnixMilli(result[0].(int64))
+	leased := result[1].(int64)
+	taken := result[2].([]interface{})
+
+	delivered := 0
+	var badCron error
+	for _, item := range taken {
+		fields := item.([]interface{})
+		score, _ := strconv.ParseFloat(fields[1].(string), 64)
+		due := int64(score)
+		job := ScheduledJob{ID: fields[0].(string), Due: time.UnixMilli(due), Body: fields[2].(string), Cron: fields[3].(string)}
+		message := job.ID + ":" + strconv.FormatInt(due, 10)
+		jobLeased := leased
+
+		// when the job is due next, 0 when it is done for good
+		next := int64(0)
+		if job.Cron != "" {
+			schedule, err := cron.ParseStandard(job.Cron)
+			if err != nil {
+				if badCron == nil {
+					badCron = fmt.Errorf("redis: cron expression %q of job %s, dead lettered: %w", job.Cron, job.ID, err)
+				}
+				if _, err := s.finish(ctx, job, jobLeased, 0, 0, message, true); err != nil {
+					return delivered, err
+				}
+				continue
+			}
+			next = schedule.Next(now).UnixMilli()
+		}
+		retry := time.Duration(0)
+		if handler != nil {
+			message = ""
+			// the batch was leased at once and the handlers before this one took their time
+			renewed, err := scheduleLeaseScript.Run(ctx, s.client.client, []string{s.key("scheduled")}, job.ID, jobLeased, s.opts.Lease.Milliseconds()).Int64()
+			if err != nil {
+				return delivered, err
+			}
+			if renewed == 0 {
+				continue // cancelled, rescheduled or taken by another poller meanwhile
+			}
+			jobLeased = renewed
+			if err := runJob(ctx, handler, job); err != nil {
+				retry = s.opts.RetryDelay
+			}
+		}
+
+		done, err := s.finish(ctx, job, jobLeased, next, retry, message, false)
+		if err != nil {
+			return delivered, err
+		}
+		if done && retry == 0 {
+			delivered++
+		}
+	}
+	return delivered, badCron
+}
+
+// a panicking handler fails its job like an error, the rest of the batch still runs
+func runJob(ctx context.Context, handler JobHandler, job ScheduledJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("redis: handler of job %s panicked: %v", job.ID, r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// reschedule or remove a taken job, pushing message to the queue (or its dead letters) first.
+// a retry is due after the delay on the redis clock. false when the lease was not ours anymore
+func (s *Scheduler) finish(ctx context.Context, job ScheduledJob, leased int64, next int64, retry time.Duration, message string, dead bool) (bool, error) {
+	target := s.key("pending")
+	if dead {
+		target = s.key("dead")
+	}
+	keys := []string{s.key("scheduled"), s.key("jobs"), s.key("cron"), target, s.key("messages")}
+	done, err := scheduleFinishScript.Run(ctx, s.client.client, keys, job.ID, leased, next, retry.Milliseconds(), message, job.Body).Int()
+	return done == 1, err
+}
+
+// Poll() every interval until ctx is done, run it in a goroutine. several pollers (on other
+// instances) share the work. failed polls are logged and retried on the next tick
+func (s *Scheduler) RunPoller(ctx context.Context, interval time.Duration, handler JobHandler) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Poll(ctx, handler); err != nil && ctx.Err() == nil {
+				s.opts.Logger.Printf("redis: polling scheduled jobs of %s: %v", s.name, err)
+			}
+		}
+	}
+}
+
+// KEYS scheduled, jobs, cron. ARGV lease (ms), batch
+// returns {now, leased until, {{id, due, body, cron} of every taken job}}
+var scheduleTakeScript = redis.NewScript(serverNow + `
+local leased = now + tonumber(ARGV[1])
+local due = redis.call("zrangebyscore", KEYS[1], "-inf", now, "withscores", "limit", 0, ARGV[2])
+local taken = {}
+for i = 1, #due, 2 do
+	redis.call("zadd", KEYS[1], leased, due[i])
+	taken[#taken + 1] = {due[i], due[i + 1], redis.call("hget", KEYS[2], due[i]) or "", redis.call("hget", KEYS[3], due[i]) or ""}
+end
+return {now, leased, taken}`)
+
+// push the lease of a taken job to lease ms from now, while it is still ours
+// KEYS scheduled. ARGV id, leased until, lease (ms). returns the new lease end, 0 when it is gone
+var scheduleLeaseScript = redis.NewScript(serverNow + `
+if tonumber(redis.call("zscore", KEYS[1], ARGV[1]) or "-1") ~= tonumber(ARGV[2]) then
+	return 0
+end
+local leased = now + tonumber(ARGV[3])
+redis.call("zadd", KEYS[1], leased, ARGV[1])
+return leased`)
+
+// only while the job is still leased by us (not cancelled or rescheduled meanwhile)
+// KEYS scheduled, jobs, cron, queue pending (or dead letters), queue messages
+// ARGV id, leased until, next due (0 removes the job), retry after (ms, 0 for none, wins over next
+// due), message id (empty pushes nothing), body
+var scheduleFinishScript = redis.NewScript(serverNow + `
+if tonumber(redis.call("zscore", KEYS[1], ARGV[1]) or "-1") ~= tonumber(ARGV[2]) then
+	return 0
+end
+if ARGV[5] ~= "" then
+	redis.call("hset", KEYS[5], ARGV[5], ARGV[6])
+	redis.call("lpush", KEYS[4], ARGV[5])
+end
+local due = tonumber(ARGV[3])
+if tonumber(ARGV[4]) > 0 then
+	due = now + tonumber(ARGV[4])
+end
+if due > 0 then
+	redis.call("zadd", KEYS[1], due, ARGV[1])
+else
+	redis.call("zrem", KEYS[1], ARGV[1])
+	redis.call("hdel", KEYS[2], ARGV[1])
+	redis.call("hdel", KEYS[3], ARGV[1])
+end
+return 1`)
@@ -0,0 +1,175 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchedulerDeliversToQueue(t *testing.T) {
+	r := newTestRedis(t)
+	ctx := context.Background()
+	s := NewScheduler(r.client, "jobs", SchedulerOptions{})
+	q := NewReliableQueue(r.client, "jobs", ReliableQueueOptions{Consumer: "a"})
+
+	// long past on our clock, due in a second on the redis clock
+	due := r.now.Add(time.Second)
+	if _, err := s.ScheduleAt(ctx, "report", "body", due); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Poll(ctx, nil); n != 0 || err != nil {
+		t.Fatalf("polled early: %d %v", n, err)
+	}
+	r.advance(time.Second)
+	if n, err := s.Poll(ctx, nil); n != 1 || err != nil {
+		t.Fatalf("poll: %d %v", n, err)
+	}
+
+	message, err := q.Pop(ctx)
+	if err != nil || message.Body != "body" || message.ID != "report:"+strconv.FormatInt(due.UnixMilli(), 10) {
+		t.Fatalf("%+v %v", message, err)
+	}
+	if _, err := s.Get(ctx, "report"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delivered job still scheduled: %v", err)
+	}
+}
+
+func TestSchedulerCronAndRetry(t *testing.T) {
+	r := newTestRedis(t)
+	ctx := context.Background()
+	s := NewScheduler(r.client, "jobs", SchedulerOptions{RetryDelay: 10 * time.Second})
+	if _, err := s.ScheduleCron(ctx, "tick", "body", "@every 1m"); err != nil {
+		t.Fatal(err)
+	}
+	// the first run was computed on our clock, catch the server up with it
+	job, _ := s.Get(ctx, "tick")
+	r.advance(job.Due.Sub(r.now))
+
+	var fail error
+	runs := 0
+	handler := func(ctx context.Context, job ScheduledJob) error {
+		runs++
+		if fail != nil {
+			panic(fail)
+		}
+		return nil
+	}
+
+	// rescheduled a minute after the run, on the redis clock
+	if n, err := s.Poll(ctx, handler); n != 1 || err != nil || runs != 1 {
+		t.Fatalf("poll: %d %v, %d runs", n, err, runs)
+	}
+	job, err := s.Get(ctx, "tick")
+	if err != nil || !job.Due.Equal(r.now.Add(time.Minute)) || job.Cron != "@every 1m" {
+		t.Fatalf("%+v %v", job, err)
+	}
+
+	// a panic is retried after RetryDelay, not at the next occurrence
+	r.advance(time.Minute)
+	fail = errors.New("boom")
+	if n, err := s.Poll(ctx, handler); n != 0 || err != nil || runs != 2 {
+		t.Fatalf("failing poll: %d %v, %d runs", n, err, runs)
+	}
+	if job, _ := s.Get(ctx, "tick"); !job.Due.Equal(r.now.Add(10 * time.Second)) {
+		t.Errorf("retry due %v, want %v", job.Due, r.now.Add(10*time.Second))
+	}
+	fail = nil
+	r.advance(10 * time.Second)
+	if n, err := s.Poll(ctx, handler); n != 1 || err != nil || runs != 3 {
+		t.Fatalf("retried poll: %d %v, %d runs", n, err, runs)
+	}
+}
+
+// a handler cancelling its own (taken) job: finishing it must not bring it back
+func TestSchedulerCancelTakenJob(t *testing.T) {
+	r := newTestRedis(t)
+	ctx := context.Background()
+	s := NewScheduler(r.client, "jobs", SchedulerOptions{})
+	s.ScheduleAt(ctx, "once", "body", r.now)
+	s.ScheduleAt(ctx, "cron", "body", r.now)
+	r.HSet(s.key("cron"), "cron", "@every 1m")
+
+	handler := func(ctx context.Context, job ScheduledJob) error {
+		if cancelled, err := s.Cancel(ctx, job.ID); !cancelled || err != nil {
+			t.Errorf("cancel %s: %v %v", job.ID, cancelled, err)
+		}
+		return nil
+	}
+	if n, err := s.Poll(ctx, handler); n != 0 || err != nil {
+		t.Fatalf("poll: %d %v", n, err)
+	}
+	if n, _ := s.Len(ctx); n != 0 {
+		t.Errorf("%d jobs left", n)
+	}
+	if keys := r.Keys(); len(keys) != 0 {
+		t.Errorf("left behind %v", keys)
+	}
+}
+
+// the batch is leased at once, every handler gets a fresh lease right before it runs. a job a
+// second poller took after the lease ran out is left to that poller
+func TestSchedulerLeasePerJob(t *testing.T) {
+	r := newTestRedis(t)
+	ctx := context.Background()
+	s := NewScheduler(r.client, "jobs", SchedulerOptions{Lease: time.Second})
+	for i, id := range []string{"a", "b", "c"} {
+		s.ScheduleAt(ctx, id, "body", r.now.Add(time.Duration(i)*time.Millisecond))
+	}
+	r.advance(time.Second)
+
+	var ran []string
+	handler := func(ctx context.Context, job ScheduledJob) error {
+		ran = append(ran, job.ID)
+		if leased, _ := s.Get(ctx, job.ID); !leased.Due.Equal(r.now.Add(time.Second)) {
+			t.Errorf("%s leased until %v, want %v", job.ID, leased.Due, r.now.Add(time.Second))
+		}
+		switch job.ID {
+		case "a":
+			r.advance(600 * time.Millisecond) // b and c still within the batch lease
+		case "b":
+			r.advance(600 * time.Millisecond) // the lease of c ran out, someone else takes it
+			other := NewScheduler(r.client, "jobs", SchedulerOptions{Lease: time.Second})
+			if n, err := other.Poll(ctx, func(ctx context.Context, job ScheduledJob) error {
+				ran = append(ran, "other "+job.ID)
+				return nil
+			}); n != 1 || err != nil {
+				t.Errorf("second poller: %d %v", n, err)
+			}
+		}
+		return nil
+	}
+	if n, err := s.Poll(ctx, handler); n != 2 || err != nil {
+		t.Fatalf("poll: %d %v", n, err)
+	}
+	if strings.Join(ran, ",") != "a,b,other c" {
+		t.Errorf("ran %v", ran)
+	}
+	if n, _ := s.Len(ctx); n != 0 {
+		t.Errorf("%d jobs left", n)
+	}
+}
+
+func TestSchedulerBadCronDeadLettered(t *testing.T) {
+	r := newTestRedis(t)
+	ctx := context.Background()
+	s := NewScheduler(r.client, "jobs", SchedulerOptions{})
+	q := NewReliableQueue(r.client, "jobs", ReliableQueueOptions{Consumer: "a"})
+	s.ScheduleAt(ctx, "bad", "body", r.now)
+	r.HSet(s.key("cron"), "bad", "not a cron")
+	s.ScheduleAt(ctx, "good", "body", r.now)
+
+	n, err := s.Poll(ctx, nil)
+	if n != 1 || err == nil || !strings.Contains(err.Error(), `cron expression "not a cron" of job bad, dead lettered`) {
+		t.Fatalf("poll: %d %v", n, err)
+	}
+	dead, err := q.DeadLetters(ctx, 10)
+	if err != nil || len(dead) != 1 || !strings.HasPrefix(dead[0].ID, "bad:") || dead[0].Body != "body" {
+		t.Fatalf("dead letters: %+v %v", dead, err)
+	}
+	if n, _ := s.Len(ctx); n != 0 {
+		t.Errorf("%d jobs left", n)
+	}
+}